@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fileforge/internal/database"
+	"fileforge/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const adminActorCtxKey contextKey = "admin_actor"
+
+const anonymousActor = "anonymous"
+
+// anonAuditLimit caps the audit rows written per minute for rejected
+// anonymous admin calls. They are not rate limited like session routes,
+// so without a cap anyone could grow the log at will.
+const anonAuditLimit = 60
+
+// anonAudit counts the rejected anonymous calls audited in the current
+// one-minute window.
+type anonAudit struct {
+	mu      sync.Mutex
+	start   time.Time
+	written int
+	skipped int
+}
+
+// allow reports whether a rejected anonymous call at now is audited. When a
+// new window starts it also returns how many calls the last one skipped.
+func (s *anonAudit) allow(now time.Time) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var skipped int
+	if now.Sub(s.start) >= time.Minute {
+		skipped = s.skipped
+		s.start, s.written, s.skipped = now, 0, 0
+	}
+	if s.written >= anonAuditLimit {
+		s.skipped++
+		return false, skipped
+	}
+	s.written++
+	return true, skipped
+}
+
+func adminActorFromCtx(r *http.Request) string {
+	s, _ := r.Context().Value(adminActorCtxKey).(string)
+	return s
+}
+
+// adminMiddleware authenticates admin calls with a bearer token or a verified
+// client certificate (only present on the mTLS listener) and records every
+// call, including rejected ones, in the audit log. Rejected anonymous calls
+// are recorded up to anonAuditLimit a minute.
+func (a *app) adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		actor := a.adminActor(r)
+
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if actor == anonymousActor {
+				ok, skipped := a.anonAudits.allow(time.Now())
+				if skipped > 0 {
+					log.Printf("[admin] %d rejected anonymous calls were not audited", skipped)
+				}
+				if !ok {
+					return
+				}
+			}
+			a.auditAdminCall(r, actor, status)
+		}()
+
+		if actor == "" {
+			actor = anonymousActor
+			if len(a.cfg.AdminTokens) == 0 && !a.cfg.AdminMTLSEnabled() {
+				writeError(ww, http.StatusForbidden, "Admin API is not configured")
+				return
+			}
+			ww.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(ww, http.StatusUnauthorized, "Admin authentication required")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), adminActorCtxKey, actor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
+
+func (a *app) adminActor(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || token == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	for _, t := range a.cfg.AdminTokens {
+		want := sha256.Sum256([]byte(t.Token))
+		if subtle.ConstantTimeCompare(sum[:], want[:]) == 1 {
+			return "token:" + t.Name
+		}
+	}
+	return ""
+}
+
+func (a *app) auditAdminCall(r *http.Request, actor string, status int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entry := models.AdminAuditEntry{
+		Actor:     actor,
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+		Status:    status,
+		RemoteIP:  clientIP(r),
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+	if err := a.db.InsertAdminAudit(ctx, entry); err != nil {
+		log.Printf("[admin] audit write failed (%s %s by %s): %v", r.Method, entry.Path, actor, err)
+	}
+}
+
+func (a *app) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := a.db.GetAdminStats(r.Context())
+	if err != nil {
+		log.Printf("[admin] stats error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch stats")
+		return
+	}
+
+	stats.StorageUsedMB = a.store.UsedMB()
+
+	queueLen, err := a.queue.Length(r.Context())
+	if err == nil {
+		stats.QueueLength = int(queueLen)
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (a *app) handleAdminListJobs(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r)
+	q := r.URL.Query()
+
+	sessionID := q.Get("session_id")
+	if sessionID != "" && !isValidUUID(sessionID) {
+		writeError(w, http.StatusBadRequest, "Invalid session_id")
+		return
+	}
+
+	jobs, err := a.db.ListJobs(r.Context(), database.JobFilter{
+		Status:    q.Get("status"),
+		Operation: q.Get("operation"),
+		SessionID: sessionID,
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		log.Printf("[admin] list jobs error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	resp := make([]models.AdminJobResponse, 0, len(jobs))
+	for _, j := range jobs {
+		resp = append(resp, j.ToAdminResponse())
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"jobs":   resp,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (a *app) handleAdminExpireJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "id")
+	if !isValidUUID(jobID) {
+		writeError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	deleted, err := a.db.DeleteJob(r.Context(), jobID)
+	if err != nil {
+		log.Printf("[admin] expire job %s error: %v", jobID, err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !deleted {
+		writeError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	a.store.DeleteJobFiles(jobID)
+
+	log.Printf("[admin] Job %s force-expired by %s", jobID, adminActorFromCtx(r))
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "expired",
+		"id":     jobID,
+	})
+}
+
+func (a *app) handleAdminRetryJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	jobID := chi.URLParam(r, "id")
+	if !isValidUUID(jobID) {
+		writeError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	job, err := a.db.GetJob(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "Job not found")
+		} else {
+			log.Printf("[admin] retry fetch %s error: %v", jobID, err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+		}
+		return
+	}
+
+	if job.Status != models.StatusFailed {
+		writeError(w, http.StatusConflict, "Only failed jobs can be retried")
+		return
+	}
+
+	if !a.store.InputExists(jobID) {
+		writeError(w, http.StatusGone, "Input file is no longer available")
+		return
+	}
+
+	ok, err := a.db.RetryJob(ctx, jobID)
+	if err != nil {
+		log.Printf("[admin] retry job %s error: %v", jobID, err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusConflict, "Only failed jobs can be retried")
+		return
+	}
+
+	if err := a.queue.Enqueue(ctx, jobID); err != nil {
+		log.Printf("[admin] retry enqueue %s error: %v", jobID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to queue job")
+		return
+	}
+
+	log.Printf("[admin] Job %s requeued by %s", jobID, adminActorFromCtx(r))
+
+	job, err = a.db.GetJob(ctx, jobID)
+	if err != nil {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "requeued", "id": jobID})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job.ToAdminResponse())
+}
+
+func (a *app) handleAdminListSessions(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r)
+	flagged := r.URL.Query().Get("flagged") == "true"
+
+	sessions, err := a.db.ListSessions(r.Context(), flagged, limit, offset)
+	if err != nil {
+		log.Printf("[admin] list sessions error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if sessions == nil {
+		sessions = []*models.Session{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions": sessions,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+func (a *app) handleAdminUnflagIP(w http.ResponseWriter, r *http.Request) {
+	ip := net.ParseIP(chi.URLParam(r, "ip"))
+	if ip == nil {
+		writeError(w, http.StatusBadRequest, "Invalid IP address")
+		return
+	}
+
+	ok, err := a.db.UnflagIP(r.Context(), ip.String())
+	if err != nil {
+		log.Printf("[admin] unflag %s error: %v", ip, err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "No session for this IP")
+		return
+	}
+
+	log.Printf("[admin] IP %s unflagged by %s", ip, adminActorFromCtx(r))
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "unflagged",
+		"ip":     ip.String(),
+	})
+}
+
+func (a *app) handleAdminQueue(w http.ResponseWriter, r *http.Request) {
+	lanes, err := a.queue.Lanes(r.Context(), 20)
+	if err != nil {
+		log.Printf("[admin] queue lanes error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Queue error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"lanes": lanes})
+}
+
+func (a *app) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r)
+
+	entries, err := a.db.ListAdminAudit(r.Context(), limit, offset)
+	if err != nil {
+		log.Printf("[admin] audit list error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if entries == nil {
+		entries = []models.AdminAuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+func pageParams(r *http.Request) (limit, offset int) {
+	limit = 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = min(v, 500)
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	return limit, offset
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"fileforge/internal/fetch"
+	"fileforge/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	apiKeyCtxKey contextKey = "api_key"
+
+	apiKeyPrefix        = "ffk_"
+	webhookSecretPrefix = "whsec_"
+
+	maxCallbackURLLen      = 2048
+	minWebhookSecretLength = 16
+)
+
+func apiKeyFromCtx(r *http.Request) *models.APIKey {
+	k, _ := r.Context().Value(apiKeyCtxKey).(*models.APIKey)
+	return k
+}
+
+// withAPIKey resolves an optional API key from X-API-Key or a Bearer token.
+// Requests without one carry on anonymously; an unknown or revoked key is
+// rejected rather than silently downgraded.
+func (a *app) withAPIKey(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	raw := strings.TrimSpace(r.Header.Get("X-API-Key"))
+	if raw == "" {
+		if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			raw = strings.TrimSpace(v)
+		}
+	}
+	if raw == "" {
+		return r, true
+	}
+
+	key, err := a.db.GetActiveAPIKey(r.Context(), hashAPIKey(raw))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[apikey] lookup error: %v", err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+			return nil, false
+		}
+		writeError(w, http.StatusUnauthorized, "Invalid API key")
+		return nil, false
+	}
+
+	if err := a.db.TouchAPIKey(r.Context(), key.ID); err != nil {
+		log.Printf("[apikey] %v", err)
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), apiKeyCtxKey, key)), true
+}
+
+// validateCallbackURL checks a job's callback_url and returns the API key
+// whose webhook secret will sign the deliveries.
+func validateCallbackURL(r *http.Request, raw string) (string, error) {
+	key := apiKeyFromCtx(r)
+	if key == nil {
+		return "", newAPIError(http.StatusBadRequest, "callback_url requires an API key")
+	}
+	if len(raw) > maxCallbackURLLen {
+		return "", newAPIError(http.StatusBadRequest, "callback_url is too long")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || fetch.CheckURL(u) != nil {
+		return "", newAPIError(http.StatusBadRequest, "callback_url must be an http or https URL")
+	}
+	return key.ID, nil
+}
+
+func hashAPIKey(raw string) []byte {
+	sum := sha256.Sum256([]byte(raw))
+	return sum[:]
+}
+
+func randomToken(prefix string, n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + encode(b), nil
+}
+
+func (a *app) handleAdminListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.db.ListAPIKeys(r.Context())
+	if err != nil {
+		log.Printf("[admin] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	out := make([]models.APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, k.ToResponse())
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"api_keys": out})
+}
+
+type apiKeyRequest struct {
+	Name          string `json:"name"`
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+func (a *app) handleAdminCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if err := decodeAdminJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		writeError(w, http.StatusBadRequest, "name must be 1-100 characters")
+		return
+	}
+
+	secret, err := a.webhookSecret(req.WebhookSecret)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	raw, err := randomToken(apiKeyPrefix, 32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	key, err := a.db.CreateAPIKey(r.Context(), req.Name, hashAPIKey(raw), raw[:len(apiKeyPrefix)+6], secret)
+	if err != nil {
+		log.Printf("[admin] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	log.Printf("[admin] API key %s (%s) created by %s", key.ID, key.Name, adminActorFromCtx(r))
+
+	resp := key.ToResponse()
+	resp.Key = raw
+	resp.WebhookSecret = secret
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (a *app) handleAdminRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID := chi.URLParam(r, "id")
+	if !isValidUUID(keyID) {
+		writeError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	ok, err := a.db.RevokeAPIKey(r.Context(), keyID)
+	if err != nil {
+		log.Printf("[admin] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	log.Printf("[admin] API key %s revoked by %s", keyID, adminActorFromCtx(r))
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked", "id": keyID})
+}
+
+// handleAdminSetWebhookSecret sets or, with an empty body, rotates the
+// secret used to sign this key's webhook deliveries, including retries of
+// deliveries already queued.
+func (a *app) handleAdminSetWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	keyID := chi.URLParam(r, "id")
+	if !isValidUUID(keyID) {
+		writeError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	var req apiKeyRequest
+	if err := decodeAdminJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	secret, err := a.webhookSecret(req.WebhookSecret)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	key, err := a.db.SetWebhookSecret(r.Context(), keyID, secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "API key not found")
+		} else {
+			log.Printf("[admin] %v", err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+		}
+		return
+	}
+
+	log.Printf("[admin] Webhook secret of API key %s changed by %s", keyID, adminActorFromCtx(r))
+
+	resp := key.ToResponse()
+	resp.WebhookSecret = secret
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *app) webhookSecret(requested string) (string, error) {
+	if requested == "" {
+		secret, err := randomToken(webhookSecretPrefix, 32, hex.EncodeToString)
+		if err != nil {
+			return "", &apiError{Status: http.StatusInternalServerError, Msg: "Internal error", Err: err}
+		}
+		return secret, nil
+	}
+	if len(requested) < minWebhookSecretLength || len(requested) > 256 {
+		return "", newAPIError(http.StatusBadRequest, "webhook_secret must be 16-256 characters")
+	}
+	return requested, nil
+}
+
+// decodeAdminJSON reads an optional small JSON body; an empty body leaves v
+// untouched.
+func decodeAdminJSON(r *http.Request, v interface{}) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 16<<10))
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"fileforge/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type batchManifestEntry struct {
+	File      string                 `json:"file"`
+	Operation string                 `json:"operation"`
+	Params    map[string]interface{} `json:"params"`
+}
+
+type batchItem struct {
+	file *streamedFile
+	spec uploadSpec
+}
+
+func (a *app) handleCreateBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, a.cfg.MaxBatchSize+10<<20)
+
+	form, err := a.readStreamedForm(r, session.ID, formLimits{
+		MaxFiles:     a.cfg.MaxBatchFiles,
+		MaxFileSize:  a.cfg.MaxFileSize,
+		MaxTotalSize: a.cfg.MaxBatchSize,
+	}, nil)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	files := form.Files
+	if len(files) == 0 {
+		writeError(w, http.StatusBadRequest, "No files provided. Use field name 'file' for each file.")
+		return
+	}
+
+	reject := func(status int, msg string) {
+		a.discardStreamed(files)
+		writeError(w, status, msg)
+	}
+
+	if err := noSteps(form.Values); err != nil {
+		a.discardStreamed(files)
+		writeAPIError(w, err)
+		return
+	}
+
+	manifest, err := parseBatchManifest(form.Get("manifest"), files)
+	if err != nil {
+		reject(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sharedOp := strings.TrimSpace(form.Get("operation"))
+	shared := paramFields(form.Values)
+	if name := strings.TrimSpace(form.Get("preset")); name != "" {
+		sharedOp, shared, err = a.applyPreset(r, name, sharedOp, shared)
+		if err != nil {
+			a.discardStreamed(files)
+			writeAPIError(w, err)
+			return
+		}
+	}
+
+	retention, burn, err := a.parseRetention(form.Get("retention_hours"), form.Get("delete_after_download"))
+	if err != nil {
+		a.discardStreamed(files)
+		writeAPIError(w, err)
+		return
+	}
+
+	items := make([]batchItem, 0, len(files))
+	var total int64
+	for _, f := range files {
+		operation, fields := sharedOp, shared
+		if entry, ok := manifest[f.Filename]; ok {
+			operation, fields = entry.resolve(sharedOp, shared)
+		}
+
+		params, err := a.validateUpload(operation, f.Filename, f.Format, f.Size, fields)
+		if err != nil {
+			var ae *apiError
+			if errors.As(err, &ae) {
+				reject(ae.Status, fmt.Sprintf("%s: %s", f.Filename, ae.Msg))
+				return
+			}
+			a.discardStreamed(files)
+			writeAPIError(w, err)
+			return
+		}
+
+		total += f.Size
+		items = append(items, batchItem{
+			file: f,
+			spec: uploadSpec{
+				Operation:      operation,
+				Params:         params,
+				OriginalName:   f.Filename,
+				DetectedFormat: f.Format,
+				Size:           f.Size,
+
+				RetentionHours:      retention,
+				DeleteAfterDownload: burn,
+			},
+		})
+	}
+
+	batch, err := a.db.CreateBatch(ctx, session.ID, a.retentionHours(retention))
+	if err != nil {
+		log.Printf("[batch] create error: %v", err)
+		reject(http.StatusInternalServerError, "Failed to create batch")
+		return
+	}
+
+	jobs := make([]*models.Job, 0, len(items))
+	for i, item := range items {
+		item.spec.BatchID = batch.ID
+
+		job, _, err := a.createStoredJob(ctx, session, item.file.JobID, item.spec, item.file.Hash)
+		if err != nil {
+			log.Printf("[batch] %s: create job for %s failed: %v", batch.ID, item.file.Filename, err)
+			a.discardStreamed(files[i+1:])
+			a.deleteBatch(ctx, batch.ID)
+			writeAPIError(w, err)
+			return
+		}
+		jobs = append(jobs, job)
+	}
+
+	log.Printf("[batch] Batch %s created with %d jobs (%s)", batch.ID, len(jobs), formatBytes(total))
+	writeJSON(w, http.StatusCreated, batch.ToResponse(jobs))
+}
+
+func (a *app) handleGetBatch(w http.ResponseWriter, r *http.Request) {
+	batch, ok := a.sessionBatch(w, r)
+	if !ok {
+		return
+	}
+
+	jobs, err := a.db.ListBatchJobs(r.Context(), batch.ID)
+	if err != nil {
+		log.Printf("[batch] list jobs for %s: %v", batch.ID, err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, batch.ToResponse(jobs))
+}
+
+func (a *app) handleDeleteBatch(w http.ResponseWriter, r *http.Request) {
+	batch, ok := a.sessionBatch(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := a.deleteBatch(r.Context(), batch.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	log.Printf("[delete] Batch %s deleted with %d jobs", batch.ID, n)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":       "deleted",
+		"id":           batch.ID,
+		"jobs_deleted": n,
+	})
+}
+
+func (a *app) deleteBatch(ctx context.Context, batchID string) (int, error) {
+	ids, _, err := a.db.DeleteBatch(ctx, batchID)
+	if err != nil {
+		log.Printf("[batch] delete %s error: %v", batchID, err)
+		return 0, err
+	}
+	for _, id := range ids {
+		a.store.DeleteJobFiles(id)
+	}
+	return len(ids), nil
+}
+
+// sessionBatch loads the batch named in the URL and makes sure it belongs to
+// the calling session. Batches of other sessions are reported as not found.
+func (a *app) sessionBatch(w http.ResponseWriter, r *http.Request) (*models.Batch, bool) {
+	batchID := chi.URLParam(r, "id")
+	if !isValidUUID(batchID) {
+		writeError(w, http.StatusBadRequest, "Invalid batch ID")
+		return nil, false
+	}
+
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return nil, false
+	}
+
+	batch, err := a.db.GetBatch(r.Context(), batchID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "Batch not found")
+		} else {
+			log.Printf("[batch] db error for %s: %v", batchID, err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+		}
+		return nil, false
+	}
+
+	if batch.SessionID != session.ID {
+		writeError(w, http.StatusNotFound, "Batch not found")
+		return nil, false
+	}
+	return batch, true
+}
+
+func parseBatchManifest(raw string, files []*streamedFile) (map[string]batchManifestEntry, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var entries []batchManifestEntry
+	if err := json.Unmarshal([]byte(raw), &entries); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+
+	uploaded := make(map[string]int, len(files))
+	for _, f := range files {
+		uploaded[f.Filename]++
+	}
+
+	manifest := make(map[string]batchManifestEntry, len(entries))
+	for _, e := range entries {
+		switch {
+		case e.File == "":
+			return nil, fmt.Errorf("manifest entries need a 'file' name")
+		case uploaded[e.File] == 0:
+			return nil, fmt.Errorf("manifest references %q, which was not uploaded", e.File)
+		case uploaded[e.File] > 1:
+			return nil, fmt.Errorf("manifest entry %q matches more than one uploaded file", e.File)
+		}
+		if _, dup := manifest[e.File]; dup {
+			return nil, fmt.Errorf("manifest lists %q more than once", e.File)
+		}
+		manifest[e.File] = e
+	}
+	return manifest, nil
+}
+
+// resolve returns the operation and parameter fields for a manifest entry.
+// Entry params override the shared form fields, which only apply when the
+// entry keeps the shared operation.
+func (e batchManifestEntry) resolve(sharedOp string, shared map[string]string) (string, map[string]string) {
+	operation := strings.TrimSpace(e.Operation)
+	inherit := operation == "" || operation == sharedOp
+	if operation == "" {
+		operation = sharedOp
+	}
+
+	fields := make(map[string]string, len(shared)+len(e.Params))
+	if inherit {
+		for k, v := range shared {
+			fields[k] = v
+		}
+	}
+	for k, v := range e.Params {
+		if v != nil {
+			fields[k] = strings.TrimSpace(fmt.Sprint(v))
+		}
+	}
+	return operation, fields
+}
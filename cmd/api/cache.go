@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	filecrypto "fileforge/internal/crypto"
+	"fileforge/internal/models"
+)
+
+// completeFromCache finishes job without processing when the same session
+// already has an unexpired result for an identical input, operation and
+// parameters. The cached output is re-encrypted under the new job's key so
+// both jobs keep independent lifecycles.
+func (a *app) completeFromCache(ctx context.Context, job *models.Job, params models.JobParams, inputHash []byte) (*models.Job, bool) {
+	if !a.cfg.ResultCacheEnabled {
+		return nil, false
+	}
+
+	cached, err := a.db.FindCachedResult(ctx, job.SessionID, job.Operation, params, inputHash, job.ID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[cache] lookup error for %s: %v", job.ID, err)
+		}
+		return nil, false
+	}
+
+	if !a.store.OutputExists(cached.ID) {
+		return nil, false
+	}
+
+	size, err := a.copyOutput(cached, job)
+	if err != nil {
+		log.Printf("[cache] copy %s → %s failed: %v", cached.ID, job.ID, err)
+		a.store.DeleteOutput(job.ID)
+		return nil, false
+	}
+
+	outputName := models.OutputName(job.OriginalName, params.OutputFormat)
+	done, err := a.db.CompleteJobFromCache(ctx, job.ID, outputName, size, inputHash)
+	if err != nil {
+		log.Printf("[cache] complete %s error: %v", job.ID, err)
+		a.store.DeleteOutput(job.ID)
+		return nil, false
+	}
+
+	a.store.DeleteInput(job.ID)
+
+	log.Printf("[cache] Job %s served from cached result of %s", job.ID, cached.ID)
+
+	if err := a.notifier.JobFinished(ctx, done); err != nil {
+		log.Printf("[webhook] queue delivery for %s: %v", job.ID, err)
+	}
+	return done, true
+}
+
+func (a *app) copyOutput(srcJob, dstJob *models.Job) (int64, error) {
+	srcKey, err := filecrypto.DeriveOutputKey(a.cfg.MasterKey, srcJob.ID, srcJob.FileNonce)
+	if err != nil {
+		return 0, err
+	}
+	dstKey, err := filecrypto.DeriveOutputKey(a.cfg.MasterKey, dstJob.ID, dstJob.FileNonce)
+	if err != nil {
+		return 0, err
+	}
+
+	src, err := a.store.OpenOutput(srcJob.ID)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := a.store.CreateOutput(dstJob.ID)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(filecrypto.DecryptStream(srcKey, src, pw))
+	}()
+
+	counter := &countingReader{r: pr}
+	if err := filecrypto.EncryptStream(dstKey, counter, dst); err != nil {
+		pr.CloseWithError(err)
+		return 0, fmt.Errorf("re-encrypt output: %w", err)
+	}
+	if err := dst.Sync(); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
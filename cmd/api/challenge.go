@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"fileforge/internal/errcode"
+	"fileforge/internal/models"
+	"fileforge/internal/pow"
+)
+
+func (a *app) powEnabled() bool {
+	return a.cfg.PowDifficulty > 0
+}
+
+func (a *app) consumeAllowance(r *http.Request, session *models.Session) bool {
+	if !a.powEnabled() || !session.HasAllowance() {
+		return false
+	}
+
+	ok, err := a.db.ConsumeAllowance(r.Context(), session.ID)
+	if err != nil {
+		log.Printf("[session] consume allowance error for %s: %v", session.IPAddress, err)
+		return false
+	}
+	return ok
+}
+
+func (a *app) rejectSession(w http.ResponseWriter, ip string, session *models.Session) {
+	status := http.StatusTooManyRequests
+	code := errcode.RateLimited
+	msg := "Rate limit exceeded. Please try again later."
+	difficulty := a.cfg.PowDifficulty
+
+	if session.IsFlagged {
+		log.Printf("[session] Blocked flagged IP: %s (total: %d)",
+			ip, session.TotalRequestCount)
+		status = http.StatusForbidden
+		code = errcode.AccessRestricted
+		msg = "Access restricted. Too many requests from this IP."
+		difficulty = a.cfg.PowFlaggedDifficulty
+	} else {
+		log.Printf("[session] Rate limited: %s (%d/%d this hour)",
+			ip, session.HourlyRequestCount, a.cfg.RateLimitPerHour)
+		w.Header().Set("Retry-After", "3600")
+	}
+
+	resp := models.ErrorResponse{Code: string(code), Error: msg}
+	if a.powEnabled() {
+		c := pow.Issue(a.powKey, ip, difficulty, a.cfg.PowChallengeTTL)
+		resp.Challenge = &c
+	}
+	writeJSON(w, status, resp)
+}
+
+func (a *app) handleRedeemChallenge(w http.ResponseWriter, r *http.Request) {
+	if !a.powEnabled() {
+		writeError(w, http.StatusNotFound, "Challenges are disabled")
+		return
+	}
+
+	ip := clientIP(r)
+	if ip == "" {
+		writeError(w, http.StatusBadRequest, "Could not determine client IP")
+		return
+	}
+
+	var sol models.ChallengeSolution
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<10)).Decode(&sol); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	solved, err := pow.Verify(a.powKey, ip, sol.Token, sol.Nonce)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, pow.ErrWrongSubject) {
+			status = http.StatusForbidden
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+
+	ok, err := a.db.RedeemChallenge(r.Context(), solved.ID, ip, solved.ExpiresAt,
+		a.cfg.PowAllowance, a.cfg.PowAllowanceRequests)
+	if err != nil {
+		log.Printf("[challenge] redeem error for %s: %v", ip, err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusConflict, "Challenge already redeemed")
+		return
+	}
+
+	log.Printf("[challenge] %s solved a challenge, granted %d requests", ip, a.cfg.PowAllowanceRequests)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":             "ok",
+		"allowance_requests": a.cfg.PowAllowanceRequests,
+		"allowance_seconds":  int(a.cfg.PowAllowance.Seconds()),
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"fileforge/internal/models"
+	"fileforge/internal/operation"
+)
+
+// handleConvert accepts the same form as POST /api/jobs but, for small
+// files and fast operations, waits for a worker to finish the job and
+// streams the result back in the same response. Input and output are
+// stored encrypted exactly like any other job. Anything that cannot be
+// answered synchronously is returned as an ordinary async job with 202.
+func (a *app) handleConvert(w http.ResponseWriter, r *http.Request) {
+	a.runSyncJob(w, r, "", a.cfg.SyncMaxFileSize)
+}
+
+// handleProbe runs the probe operation on the uploaded file and returns its
+// metadata as JSON. Probing barely depends on file size, so any accepted
+// upload is answered synchronously unless the workers are busy.
+func (a *app) handleProbe(w http.ResponseWriter, r *http.Request) {
+	a.runSyncJob(w, r, operation.Probe, a.cfg.MaxFileSize)
+}
+
+// runSyncJob implements handleConvert and handleProbe. op fixes the
+// operation instead of reading it from the form; files larger than syncMax
+// are always processed asynchronously.
+func (a *app) runSyncJob(w http.ResponseWriter, r *http.Request, op string, syncMax int64) {
+	ctx := r.Context()
+
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, a.cfg.MaxFileSize+10<<20)
+
+	precheck := a.precheckUpload
+	if op != "" {
+		precheck = func(_ url.Values, filename, detected string) error {
+			return a.precheckUpload(url.Values{"operation": {op}}, filename, detected)
+		}
+	}
+
+	form, err := a.readStreamedForm(r, session.ID, formLimits{
+		MaxFiles:     1,
+		MaxFileSize:  a.cfg.MaxFileSize,
+		MaxTotalSize: a.cfg.MaxFileSize,
+	}, precheck)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	if len(form.Files) == 0 {
+		writeError(w, http.StatusBadRequest, "No file provided. Use field name 'file'.")
+		return
+	}
+	file := form.Files[0]
+
+	if err := noSteps(form.Values); err != nil {
+		a.discardStreamed(form.Files)
+		writeAPIError(w, err)
+		return
+	}
+
+	if op == "" {
+		op = strings.TrimSpace(form.Get("operation"))
+	}
+	fields := paramFields(form.Values)
+	if name := strings.TrimSpace(form.Get("preset")); name != "" {
+		op, fields, err = a.applyPreset(r, name, op, fields)
+		if err != nil {
+			a.discardStreamed(form.Files)
+			writeAPIError(w, err)
+			return
+		}
+	}
+
+	params, err := a.validateUpload(op, file.Filename, file.Format, file.Size, fields)
+	if err != nil {
+		a.discardStreamed(form.Files)
+		writeAPIError(w, err)
+		return
+	}
+
+	retention, burn, err := a.parseRetention(form.Get("retention_hours"), form.Get("delete_after_download"))
+	if err != nil {
+		a.discardStreamed(form.Files)
+		writeAPIError(w, err)
+		return
+	}
+
+	fallback := ""
+	switch {
+	case !operation.Get(op).Sync:
+		fallback = "operation"
+	case file.Size > syncMax:
+		fallback = "size"
+	}
+
+	if fallback == "" {
+		select {
+		case a.syncSlots <- struct{}{}:
+			defer func() { <-a.syncSlots }()
+		default:
+			fallback = "busy"
+		}
+	}
+
+	var apiKeyID string
+	if key := apiKeyFromCtx(r); key != nil {
+		apiKeyID = key.ID
+	}
+
+	job, cached, err := a.createStoredJob(ctx, session, file.JobID, uploadSpec{
+		Operation:      op,
+		Params:         params,
+		OriginalName:   file.Filename,
+		DetectedFormat: file.Format,
+		Size:           file.Size,
+		APIKeyID:       apiKeyID,
+		Priority:       fallback == "",
+
+		RetentionHours:      retention,
+		DeleteAfterDownload: burn,
+	}, file.Hash)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	w.Header().Set("X-Job-ID", job.ID)
+
+	if cached {
+		w.Header().Set("X-Cache", "hit")
+		a.serveOutput(w, r, job)
+		return
+	}
+
+	if fallback == "" {
+		job, fallback = a.waitForJob(ctx, job)
+	}
+
+	switch {
+	case fallback != "":
+		log.Printf("[convert] Job %s continues asynchronously (%s)", job.ID, fallback)
+		w.Header().Set("X-Sync-Fallback", fallback)
+		w.Header().Set("Location", "/api/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job.ToResponse())
+	case job.Status == models.StatusFailed:
+		writeJobFailed(w, job)
+	default:
+		a.serveOutput(w, r, job)
+	}
+}
+
+// waitForJob blocks until the worker signals that the job finished or the
+// sync timeout passes. A non-empty reason means the caller should fall back
+// to the async response.
+func (a *app) waitForJob(ctx context.Context, job *models.Job) (*models.Job, string) {
+	done, err := a.queue.WaitDone(ctx, job.ID, a.cfg.SyncTimeout)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("[convert] %v", err)
+		}
+		return job, "error"
+	}
+	if !done {
+		return job, "timeout"
+	}
+
+	finished, err := a.db.GetJob(ctx, job.ID)
+	if err != nil {
+		log.Printf("[convert] reload job %s: %v", job.ID, err)
+		return job, "error"
+	}
+	if finished.Status != models.StatusCompleted && finished.Status != models.StatusFailed {
+		return finished, "timeout"
+	}
+	return finished, ""
+}
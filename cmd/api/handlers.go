@@ -1,20 +1,26 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"time"
 
 	filecrypto "fileforge/internal/crypto"
 	"fileforge/internal/database"
+	"fileforge/internal/errcode"
 	"fileforge/internal/models"
+	"fileforge/internal/operation"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
 )
 
@@ -38,133 +44,166 @@ func (a *app) handleHealth(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *app) handleFormats(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "public, max-age=3600")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(formatsJSON))
+	writeJSON(w, http.StatusOK, operation.Formats())
+}
+
+func (a *app) handleErrorCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, errcode.Catalogue)
 }
 
 func (a *app) handleCreateJob(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	r.Body = http.MaxBytesReader(w, r.Body, a.cfg.MaxFileSize+10<<20)
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return
+	}
 
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		var maxErr *http.MaxBytesError
-		if errors.As(err, &maxErr) {
-			writeError(w, http.StatusRequestEntityTooLarge,
-				fmt.Sprintf("File too large. Maximum: %s", formatBytes(a.cfg.MaxFileSize)))
+	idemKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if idemKey != "" {
+		if !validIdempotencyKey(idemKey) {
+			writeErrorCode(w, http.StatusBadRequest, errcode.InvalidParameter,
+				"Idempotency-Key must be 1-255 printable ASCII characters")
 			return
 		}
-		writeError(w, http.StatusBadRequest, "Invalid form data")
-		return
-	}
-	defer func() {
-		if r.MultipartForm != nil {
-			r.MultipartForm.RemoveAll()
+		if a.replayIdempotentJob(w, r, session.ID, idemKey) {
+			return
 		}
-	}()
-
-	operation := strings.TrimSpace(r.FormValue("operation"))
-	if !models.ValidOperations[operation] {
-		writeError(w, http.StatusBadRequest,
-			fmt.Sprintf("Invalid operation: %q", operation))
-		return
 	}
 
-	file, header, err := r.FormFile("file")
+	r.Body = http.MaxBytesReader(w, r.Body, a.cfg.MaxFileSize+10<<20)
+
+	form, err := a.readStreamedForm(r, session.ID, formLimits{
+		MaxFiles:     1,
+		MaxFileSize:  a.cfg.MaxFileSize,
+		MaxTotalSize: a.cfg.MaxFileSize,
+	}, a.precheckUpload)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "No file provided. Use field name 'file'.")
+		writeAPIError(w, err)
 		return
 	}
-	defer file.Close()
+	sourceURL := strings.TrimSpace(form.Get("source_url"))
 
-	if header.Size > a.cfg.MaxFileSize {
-		writeError(w, http.StatusRequestEntityTooLarge,
-			fmt.Sprintf("File too large (%s). Maximum: %s",
-				formatBytes(header.Size), formatBytes(a.cfg.MaxFileSize)))
+	var file *streamedFile
+	switch {
+	case len(form.Files) > 0 && sourceURL != "":
+		a.discardStreamed(form.Files)
+		writeError(w, http.StatusBadRequest, "Provide either a file or source_url, not both")
 		return
-	}
-
-	if header.Size == 0 {
-		writeError(w, http.StatusBadRequest, "File is empty")
+	case len(form.Files) > 0:
+		file = form.Files[0]
+	case sourceURL != "":
+		file, err = a.importURL(ctx, session.ID, sourceURL, form.Values)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		form.Files = []*streamedFile{file}
+	default:
+		writeError(w, http.StatusBadRequest, "No file provided. Use field name 'file' or 'source_url'.")
 		return
 	}
 
-	inputExt := strings.ToLower(strings.TrimPrefix(filepath.Ext(header.Filename), "."))
-	inputExt = normalizeExt(inputExt)
+	operation := strings.TrimSpace(form.Get("operation"))
+	fields := paramFields(form.Values)
+	preset := strings.TrimSpace(form.Get("preset"))
 
-	if !models.ValidInputFormat(operation, inputExt) {
-		writeError(w, http.StatusBadRequest,
-			fmt.Sprintf("Unsupported input format .%s for %s", inputExt, operation))
-		return
+	var params models.JobParams
+	var steps []models.PipelineStep
+	if rawSteps := strings.TrimSpace(form.Get("steps")); rawSteps != "" {
+		if operation != "" || preset != "" || len(fields) > 0 {
+			a.discardStreamed(form.Files)
+			writeErrorCode(w, http.StatusBadRequest, errcode.InvalidParameter,
+				"With steps, the operation, preset and parameters go inside each step")
+			return
+		}
+		operation = models.OperationPipeline
+		steps, params, err = a.validatePipeline(r, rawSteps, file.Filename, file.Format, file.Size)
+	} else {
+		if preset != "" {
+			operation, fields, err = a.applyPreset(r, preset, operation, fields)
+		}
+		if err == nil {
+			params, err = a.validateUpload(operation, file.Filename, file.Format, file.Size, fields)
+		}
 	}
-
-	params, err := parseAndValidateParams(r, operation, inputExt)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		a.discardStreamed(form.Files)
+		writeAPIError(w, err)
 		return
 	}
 
-	session := sessionFromCtx(r)
-	if session == nil {
-		writeError(w, http.StatusInternalServerError, "Session error")
-		return
-	}
-
-	job, err := a.db.CreateJob(ctx, database.CreateJobParams{
-		SessionID:    session.ID,
-		Operation:    operation,
-		OriginalName: header.Filename,
-		InputSize:    header.Size,
-		Params:       params,
-	}, a.cfg.FileRetentionHours)
+	retention, burn, err := a.parseRetention(form.Get("retention_hours"), form.Get("delete_after_download"))
 	if err != nil {
-		log.Printf("[upload] create job error: %v", err)
-		writeError(w, http.StatusInternalServerError, "Failed to create job")
+		a.discardStreamed(form.Files)
+		writeAPIError(w, err)
 		return
 	}
 
-	key, err := filecrypto.DeriveKey(a.cfg.MasterKey, job.ID)
-	if err != nil {
-		log.Printf("[upload] key derivation error: %v", err)
-		a.db.DeleteJob(ctx, job.ID)
-		writeError(w, http.StatusInternalServerError, "Internal error")
+	var apiKeyID string
+	callbackURL := strings.TrimSpace(form.Get("callback_url"))
+	if callbackURL != "" {
+		if apiKeyID, err = validateCallbackURL(r, callbackURL); err != nil {
+			a.discardStreamed(form.Files)
+			writeAPIError(w, err)
+			return
+		}
+	} else if key := apiKeyFromCtx(r); key != nil {
+		apiKeyID = key.ID
+	}
+
+	job, cached, err := a.createStoredJob(ctx, session, file.JobID, uploadSpec{
+		Operation:      operation,
+		Params:         params,
+		Steps:          steps,
+		OriginalName:   file.Filename,
+		DetectedFormat: file.Format,
+		Size:           file.Size,
+		IdempotencyKey: idemKey,
+		APIKeyID:       apiKeyID,
+		CallbackURL:    callbackURL,
+
+		RetentionHours:      retention,
+		DeleteAfterDownload: burn,
+	}, file.Hash)
+	if errors.Is(err, database.ErrIdempotencyConflict) {
+		if !a.replayIdempotentJob(w, r, session.ID, idemKey) {
+			writeErrorCode(w, http.StatusConflict, errcode.IdempotencyConflict,
+				"A request with this Idempotency-Key is already in progress")
+		}
 		return
 	}
-
-	dstFile, err := a.store.CreateInput(job.ID)
 	if err != nil {
-		log.Printf("[upload] create storage file error: %v", err)
-		a.db.DeleteJob(ctx, job.ID)
-		writeError(w, http.StatusInternalServerError, "Storage error")
+		writeAPIError(w, err)
 		return
 	}
 
-	encErr := filecrypto.EncryptStream(key, file, dstFile)
-	syncErr := dstFile.Sync()
-	dstFile.Close()
-
-	if encErr != nil || syncErr != nil {
-		log.Printf("[upload] encrypt error: enc=%v sync=%v", encErr, syncErr)
-		a.db.DeleteJob(ctx, job.ID)
-		a.store.DeleteJobFiles(job.ID)
-		writeError(w, http.StatusInternalServerError, "Failed to process upload")
-		return
+	if cached {
+		w.Header().Set("X-Cache", "hit")
 	}
+	writeJSON(w, http.StatusCreated, job.ToResponse())
+}
 
-	if err := a.queue.Enqueue(ctx, job.ID); err != nil {
-		log.Printf("[upload] enqueue error: %v", err)
-		a.db.DeleteJob(ctx, job.ID)
-		a.store.DeleteJobFiles(job.ID)
-		writeError(w, http.StatusInternalServerError, "Failed to queue job")
-		return
+// replayIdempotentJob answers a retried POST /api/jobs with the job created
+// by the first request. It returns false if the key has not been used yet.
+func (a *app) replayIdempotentJob(w http.ResponseWriter, r *http.Request, sessionID, key string) bool {
+	job, err := a.db.GetJobByIdempotencyKey(r.Context(), sessionID, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false
+		}
+		log.Printf("[upload] idempotency lookup error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return true
 	}
 
-	log.Printf("[upload] Job %s created: %s %s (%s)",
-		job.ID, operation, header.Filename, formatBytes(header.Size))
-
+	log.Printf("[upload] Replaying job %s for Idempotency-Key", job.ID)
+	w.Header().Set("Idempotent-Replayed", "true")
 	writeJSON(w, http.StatusCreated, job.ToResponse())
+	return true
 }
 
 func (a *app) handleGetJob(w http.ResponseWriter, r *http.Request) {
@@ -205,41 +244,78 @@ func (a *app) handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.serveOutput(w, r, job)
+}
+
+// writeJobFailed answers a request for the output of a failed job with the
+// code and message recorded when it failed.
+func writeJobFailed(w http.ResponseWriter, job *models.Job) {
+	code, msg := errcode.JobFailed, "Job failed"
+	if job.ErrorCode.Valid {
+		code = errcode.Code(job.ErrorCode.String)
+	}
+	if job.ErrorMessage.Valid {
+		msg = job.ErrorMessage.String
+	}
+	writeErrorCode(w, http.StatusUnprocessableEntity, code, msg)
+}
+
+// serveOutput decrypts a completed job's output into the response and
+// reports what was sent. Range, If-Range and conditional requests are
+// handled by http.ServeContent, which only decrypts the chunks it needs.
+func (a *app) serveOutput(w http.ResponseWriter, r *http.Request, job *models.Job) delivery {
+	jobID := job.ID
+
 	if job.Status != models.StatusCompleted {
 		switch job.Status {
 		case models.StatusPending, models.StatusProcessing:
-			writeError(w, http.StatusConflict, "Job is still processing")
+			writeErrorCode(w, http.StatusConflict, errcode.JobNotReady, "Job is still processing")
 		case models.StatusFailed:
-			msg := "Job failed"
-			if job.ErrorMessage.Valid {
-				msg = job.ErrorMessage.String
-			}
-			writeError(w, http.StatusUnprocessableEntity, msg)
+			writeJobFailed(w, job)
 		default:
-			writeError(w, http.StatusConflict, "Job not ready for download")
+			writeErrorCode(w, http.StatusConflict, errcode.JobNotReady, "Job not ready for download")
 		}
-		return
+		return delivery{}
+	}
+
+	if job.DownloadedAt.Valid {
+		writeError(w, http.StatusGone, "Output was deleted after its first download")
+		return delivery{}
 	}
 
 	if !a.store.OutputExists(jobID) {
 		writeError(w, http.StatusNotFound, "Output file not found (may have expired)")
-		return
+		return delivery{}
 	}
 
-	key, err := filecrypto.DeriveKey(a.cfg.MasterKey, jobID)
+	key, err := filecrypto.DeriveOutputKey(a.cfg.MasterKey, jobID, job.FileNonce)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Internal error")
-		return
+		return delivery{}
 	}
 
 	encFile, err := a.store.OpenOutput(jobID)
 	if err != nil {
 		log.Printf("[download] open error for %s: %v", jobID, err)
 		writeError(w, http.StatusInternalServerError, "Failed to read file")
-		return
+		return delivery{}
 	}
 	defer encFile.Close()
 
+	info, err := encFile.Stat()
+	if err != nil {
+		log.Printf("[download] stat error for %s: %v", jobID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to read file")
+		return delivery{}
+	}
+
+	content, err := filecrypto.NewDecryptReader(key, encFile, info.Size())
+	if err != nil {
+		log.Printf("[download] decrypt reader error for %s: %v", jobID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to read file")
+		return delivery{}
+	}
+
 	outputName := "download"
 	if job.OutputFilename.Valid && job.OutputFilename.String != "" {
 		outputName = job.OutputFilename.String
@@ -248,18 +324,82 @@ func (a *app) handleDownload(w http.ResponseWriter, r *http.Request) {
 	ext := filepath.Ext(outputName)
 	contentType := models.MimeForExtension(ext)
 
+	var modTime time.Time
+	if job.CompletedAt.Valid {
+		modTime = job.CompletedAt.Time
+	}
+
+	// The output of a job only changes if it is retried, which also moves
+	// completed_at, so the pair identifies the exact bytes for If-Range.
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%x"`, jobID, modTime.UnixNano()))
 	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Disposition",
 		fmt.Sprintf(`attachment; filename="%s"`, sanitizeFilename(outputName)))
+	w.Header().Set("Cache-Control", "no-store")
 
-	if job.OutputSize.Valid && job.OutputSize.Int64 > 0 {
-		w.Header().Set("Content-Length", strconv.FormatInt(job.OutputSize.Int64, 10))
+	d := serveContent(w, r, modTime, content, content.Size())
+
+	// The download that shreds the output is the first one to deliver the
+	// end of the file, whether as a whole body or as the last range of a
+	// resumed or chunked download. HEAD, conditional and partial requests
+	// that stop short leave it in place.
+	if job.DeleteAfterDownload && d.Complete {
+		a.shredOutput(context.WithoutCancel(r.Context()), job)
 	}
+	return d
+}
 
-	w.Header().Set("Cache-Control", "no-store")
+// delivery describes how much of a file a response carried.
+type delivery struct {
+	// ReachesEnd is set when the response carried the file up to its last
+	// byte: a 200, or a range that ends there.
+	ReachesEnd bool
+	// Complete is set when such a response to a GET was written in full to
+	// a client that stayed connected.
+	Complete bool
+}
 
-	if err := filecrypto.DecryptStream(key, encFile, w); err != nil {
-		log.Printf("[download] decrypt stream error for %s: %v", jobID, err)
+// serveContent serves content like http.ServeContent and reports what was
+// sent. Requests for several ranges get the whole file, as the coverage of
+// a multipart/byteranges response is not worth reconstructing.
+func serveContent(w http.ResponseWriter, r *http.Request, modTime time.Time, content io.ReadSeeker, size int64) delivery {
+	if strings.Contains(r.Header.Get("Range"), ",") {
+		r.Header.Del("Range")
+	}
+
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	http.ServeContent(ww, r, "", modTime, content)
+
+	var d delivery
+	want := size
+	switch ww.Status() {
+	case http.StatusOK:
+		d.ReachesEnd = true
+	case http.StatusPartialContent:
+		var first, last, total int64
+		_, err := fmt.Sscanf(ww.Header().Get("Content-Range"), "bytes %d-%d/%d", &first, &last, &total)
+		if err == nil && last == total-1 {
+			d.ReachesEnd = true
+			want = last - first + 1
+		}
+	}
+	d.Complete = d.ReachesEnd && r.Method == http.MethodGet &&
+		int64(ww.BytesWritten()) == want && r.Context().Err() == nil
+	return d
+}
+
+// shredOutput makes a delete_after_download job's output unreadable once it
+// has been downloaded: the nonce its key was derived from is discarded and
+// the file removed.
+func (a *app) shredOutput(ctx context.Context, job *models.Job) {
+	shredded, err := a.db.ShredJobOutput(ctx, job.ID)
+	if err != nil {
+		log.Printf("[download] shred error for %s: %v", job.ID, err)
+		return
+	}
+	if shredded {
+		a.store.DeleteOutput(job.ID)
+		log.Printf("[download] Job %s output shredded after download", job.ID)
 	}
 }
 
@@ -291,118 +431,56 @@ func (a *app) handleDeleteJob(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-
-func (a *app) handleAdminStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := a.db.GetAdminStats(r.Context())
-	if err != nil {
-		log.Printf("[admin] stats error: %v", err)
-		writeError(w, http.StatusInternalServerError, "Failed to fetch stats")
+// handleUpdateJob changes how long a job is kept. The new expiry counts from
+// now and may be shorter or longer than the current one, but never later
+// than MaxRetentionHours after the job was created.
+func (a *app) handleUpdateJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.sessionJob(w, r)
+	if !ok {
 		return
 	}
 
-	stats.StorageUsedMB = a.store.UsedMB()
-
-	queueLen, err := a.queue.Length(r.Context())
-	if err == nil {
-		stats.QueueLength = int(queueLen)
+	var req models.UpdateJobRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
 	}
-
-	writeJSON(w, http.StatusOK, stats)
-}
-
-
-func parseAndValidateParams(r *http.Request, operation, inputExt string) (models.JobParams, error) {
-	var p models.JobParams
-
-	p.OutputFormat = normalizeExt(strings.TrimSpace(r.FormValue("output_format")))
-
-	switch operation {
-	case models.OpImageConvert, models.OpAudioConvert:
-		if p.OutputFormat == "" {
-			return p, fmt.Errorf("output_format is required for %s", operation)
-		}
-		if !models.ValidOutputFormat(operation, p.OutputFormat) {
-			return p, fmt.Errorf("unsupported output format: %s", p.OutputFormat)
-		}
-
-	case models.OpImageRemoveBG:
-		if p.OutputFormat == "" {
-			p.OutputFormat = "png"
-		}
-		if !models.ValidOutputFormat(operation, p.OutputFormat) {
-			return p, fmt.Errorf("background removal supports png or webp output")
-		}
-
-	case models.OpImageCompress, models.OpAudioCompress:
-		if p.OutputFormat == "" {
-			p.OutputFormat = inputExt
-		}
-
-	case models.OpVideoCompress:
-		if p.OutputFormat == "" {
-			if models.ValidOutputFormat(operation, inputExt) {
-				p.OutputFormat = inputExt
-			} else {
-				p.OutputFormat = "mp4"
-			}
-		}
-		if !models.ValidOutputFormat(operation, p.OutputFormat) {
-			return p, fmt.Errorf("unsupported video output format: %s", p.OutputFormat)
-		}
-
-	case models.OpPDFCompress:
-		p.OutputFormat = "pdf"
+	if req.RetentionHours < 1 || req.RetentionHours > a.cfg.MaxRetentionHours {
+		writeErrorCode(w, http.StatusBadRequest, errcode.InvalidParameter,
+			fmt.Sprintf("retention_hours must be between 1 and %d", a.cfg.MaxRetentionHours))
+		return
 	}
 
-	if q := r.FormValue("quality"); q != "" {
-		v, err := strconv.Atoi(q)
-		if err != nil || v < 1 || v > 100 {
-			return p, fmt.Errorf("quality must be between 1 and 100")
-		}
-		p.Quality = v
-	} else {
-		switch operation {
-		case models.OpImageCompress:
-			p.Quality = 80
-		case models.OpAudioCompress:
-			p.Quality = 70
-		case models.OpVideoCompress:
-			p.Quality = 65
-		}
+	updated, err := a.db.SetJobRetention(r.Context(), job.ID, req.RetentionHours, a.cfg.MaxRetentionHours)
+	if errors.Is(err, database.ErrRetentionTooLong) {
+		limit := job.CreatedAt.Add(time.Duration(a.cfg.MaxRetentionHours) * time.Hour)
+		writeErrorCode(w, http.StatusBadRequest, errcode.InvalidParameter,
+			fmt.Sprintf("Jobs are kept at most %d hours; this one cannot be kept past %s",
+				a.cfg.MaxRetentionHours, limit.UTC().Format(time.RFC3339)))
+		return
 	}
-
-	if r.FormValue("lossless") == "true" {
-		p.Lossless = true
+	if err != nil {
+		log.Printf("[job] retention update error for %s: %v", job.ID, err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
 	}
 
-	if d := r.FormValue("image_dpi"); d != "" {
-		v, err := strconv.Atoi(d)
-		if err != nil {
-			return p, fmt.Errorf("invalid image_dpi value")
-		}
-		valid := map[int]bool{72: true, 150: true, 300: true, 600: true}
-		if !valid[v] {
-			return p, fmt.Errorf("image_dpi must be 72, 150, 300, or 600")
-		}
-		p.ImageDPI = v
-	} else if operation == models.OpPDFCompress {
-		p.ImageDPI = 150
-	}
+	log.Printf("[job] Job %s now expires at %s", job.ID, updated.ExpiresAt.UTC().Format(time.RFC3339))
+	writeJSON(w, http.StatusOK, updated.ToResponse())
+}
 
-	if iq := r.FormValue("image_quality"); iq != "" {
-		v, err := strconv.Atoi(iq)
-		if err != nil || v < 1 || v > 100 {
-			return p, fmt.Errorf("image_quality must be between 1 and 100")
+func validIdempotencyKey(k string) bool {
+	if len(k) == 0 || len(k) > 255 {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		if k[i] < 0x21 || k[i] > 0x7e {
+			return false
 		}
-		p.ImageQuality = v
-	} else if operation == models.OpPDFCompress {
-		p.ImageQuality = 75
 	}
-
-	return p, nil
+	return true
 }
 
-
 func isValidUUID(s string) bool {
 	_, err := uuid.Parse(s)
 	return err == nil
@@ -450,39 +528,3 @@ func errStr(err error) string {
 	}
 	return err.Error()
 }
-
-const formatsJSON = `{
-  "image_convert": {
-    "input": ["jpeg","jpg","png","webp","tiff","tif","gif","avif","heif","heic","bmp"],
-    "output": ["jpeg","png","webp","tiff","gif","avif","heif","bmp"]
-  },
-  "image_compress": {
-    "input": ["jpeg","jpg","png","webp","tiff","tif","gif","avif","heif","heic","bmp"],
-    "output": "same_as_input",
-    "params": {"quality":{"type":"range","min":1,"max":100,"default":80},"lossless":{"type":"bool","default":false}}
-  },
-  "image_remove_bg": {
-    "input": ["jpeg","jpg","png","webp","tiff","tif","bmp"],
-    "output": ["png","webp"],
-    "default_output": "png"
-  },
-  "pdf_compress": {
-    "input": ["pdf"],
-    "output": ["pdf"],
-    "params": {"image_dpi":{"type":"select","options":[72,150,300,600],"default":150},"image_quality":{"type":"range","min":1,"max":100,"default":75}}
-  },
-  "audio_convert": {
-    "input": ["mp3","wav","flac","ogg","opus","aac","m4a","aiff","wma"],
-    "output": ["mp3","wav","flac","ogg","opus","aac","m4a","aiff"]
-  },
-  "audio_compress": {
-    "input": ["mp3","wav","flac","ogg","opus","aac","m4a","aiff","wma"],
-    "output": "same_as_input",
-    "params": {"quality":{"type":"range","min":1,"max":100,"default":70},"lossless":{"type":"bool","default":false}}
-  },
-  "video_compress": {
-    "input": ["mp4","mkv","webm","avi","mov"],
-    "output": ["mp4","mkv","webm"],
-    "params": {"quality":{"type":"range","min":1,"max":100,"default":65}}
-  }
-}`
\ No newline at end of file
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"fileforge/internal/errcode"
+	"fileforge/internal/fetch"
+	"fileforge/internal/models"
+	"fileforge/internal/sniff"
+
+	"github.com/google/uuid"
+)
+
+// importURL downloads source_url through the guarded fetcher and encrypts it
+// into storage exactly like an uploaded file part.
+func (a *app) importURL(ctx context.Context, sessionID, rawURL string, values url.Values) (*streamedFile, error) {
+	if a.fetcher == nil {
+		return nil, newAPIError(http.StatusBadRequest, "Importing from a URL is disabled")
+	}
+
+	resp, err := a.fetcher.Get(ctx, rawURL)
+	if err != nil {
+		return nil, a.fetchError(err)
+	}
+	defer resp.Body.Close()
+
+	body, detected, err := sniff.Reader(resp.Body)
+	if err != nil {
+		return nil, a.fetchError(err)
+	}
+
+	filename := resp.Filename
+	if normalizeExt(filepath.Ext(filename)) == "" {
+		ext := extForMime(resp.ContentType)
+		if detected != "" {
+			ext = detected
+		}
+		if ext != "" {
+			filename = strings.TrimSuffix(filename, ".") + "." + ext
+		}
+	}
+	filename = sanitizeFilename(filename)
+
+	if err := a.precheckUpload(values, filename, detected); err != nil {
+		return nil, err
+	}
+
+	f := &streamedFile{JobID: uuid.New().String(), Filename: filename, Format: detected}
+	src := &limitedPartReader{r: body, max: a.cfg.MaxFileSize}
+
+	hash, err := a.storeInput(f.JobID, sessionID, src)
+	switch {
+	case errors.Is(src.err, errPartTooLarge):
+		return nil, a.fetchError(fetch.ErrTooLarge)
+	case src.err != nil:
+		return nil, a.fetchError(src.err)
+	case err != nil:
+		log.Printf("[import] store input error: %v", err)
+		return nil, &apiError{Status: http.StatusInternalServerError, Msg: "Failed to process upload", Err: err}
+	}
+
+	f.Size = src.n
+	f.Hash = hash
+
+	if u, err := url.Parse(resp.URL); err == nil {
+		log.Printf("[import] Fetched %s from %s (%s)", filename, u.Host, formatBytes(f.Size))
+	}
+	return f, nil
+}
+
+func (a *app) fetchError(err error) *apiError {
+	switch {
+	case errors.Is(err, fetch.ErrTooLarge):
+		return &apiError{Status: http.StatusRequestEntityTooLarge, Err: err,
+			Msg: fmt.Sprintf("Remote file too large. Maximum: %s", formatBytes(a.cfg.MaxFileSize))}
+	case errors.Is(err, fetch.ErrInvalidURL):
+		return &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter, Err: err,
+			Msg: "source_url must be an http or https URL"}
+	case errors.Is(err, fetch.ErrForbiddenAddress):
+		return &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter, Err: err,
+			Msg: "source_url must point to a public address"}
+	case errors.Is(err, fetch.ErrTooManyRedirects):
+		return &apiError{Status: http.StatusBadRequest, Code: errcode.SourceFetchFailed, Err: err,
+			Msg: "source_url redirected too many times"}
+	case errors.Is(err, fetch.ErrTimeout):
+		return &apiError{Status: http.StatusGatewayTimeout, Err: err,
+			Msg: "Timed out fetching source_url"}
+	case errors.Is(err, fetch.ErrUnexpectedStatus):
+		return &apiError{Status: http.StatusBadGateway, Err: err,
+			Msg: "Could not fetch source_url: " + err.Error()}
+	default:
+		return &apiError{Status: http.StatusBadGateway, Err: err,
+			Msg: "Could not fetch source_url"}
+	}
+}
+
+// extForMime maps a Content-Type back to one of our known extensions, for
+// URLs whose path carries no usable file name.
+func extForMime(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	var exts []string
+	for ext, m := range models.MimeTypes {
+		if m == contentType {
+			exts = append(exts, ext)
+		}
+	}
+	if len(exts) == 0 {
+		return ""
+	}
+	sort.Strings(exts)
+	return exts[0]
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	filecrypto "fileforge/internal/crypto"
+	"fileforge/internal/database"
+	"fileforge/internal/errcode"
+	"fileforge/internal/models"
+	"fileforge/internal/operation"
+	"fileforge/internal/sniff"
+
+	"github.com/google/uuid"
+)
+
+type apiError struct {
+	Status int
+	Code   errcode.Code // defaults to the generic code of Status
+	Msg    string
+	Err    error
+}
+
+func (e *apiError) Error() string {
+	if e.Err != nil {
+		return e.Msg + ": " + e.Err.Error()
+	}
+	return e.Msg
+}
+
+func (e *apiError) Unwrap() error {
+	return e.Err
+}
+
+func newAPIError(status int, msg string) *apiError {
+	return &apiError{Status: status, Msg: msg}
+}
+
+func invalidOperation(op string) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Code: errcode.UnsupportedOperation,
+		Msg: fmt.Sprintf("Invalid operation: %q", op)}
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		code := ae.Code
+		if code == "" {
+			code = errcode.ForStatus(ae.Status)
+		}
+		writeErrorCode(w, ae.Status, code, ae.Msg)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "Internal error")
+}
+
+type uploadSpec struct {
+	Operation      string
+	Params         models.JobParams
+	Steps          []models.PipelineStep
+	OriginalName   string
+	DetectedFormat string
+	Size           int64
+	BatchID        string
+	IdempotencyKey string
+	APIKeyID       string
+	CallbackURL    string
+
+	// RetentionHours overrides the default retention when non-zero.
+	RetentionHours      int
+	DeleteAfterDownload bool
+
+	// Priority puts the job in the lane workers drain first.
+	Priority bool
+}
+
+// formFields are request fields that are not operation parameters. Every
+// other field of a job form is handed to the operation's schema, which
+// rejects what it does not declare.
+var formFields = map[string]bool{
+	"file":                  true,
+	"operation":             true,
+	"source_url":            true,
+	"callback_url":          true,
+	"manifest":              true,
+	"preset":                true,
+	"steps":                 true,
+	"retention_hours":       true,
+	"delete_after_download": true,
+}
+
+// paramFields returns the first value of each parameter field in values.
+func paramFields(values url.Values) map[string]string {
+	fields := make(map[string]string)
+	for k, v := range values {
+		if !formFields[k] && len(v) > 0 {
+			fields[k] = v[0]
+		}
+	}
+	return fields
+}
+
+// parseRetention validates the optional retention_hours and
+// delete_after_download fields. Zero hours means the default retention.
+func (a *app) parseRetention(hours, deleteAfterDownload string) (int, bool, error) {
+	var n int
+	if hours = strings.TrimSpace(hours); hours != "" {
+		var err error
+		n, err = strconv.Atoi(hours)
+		if err != nil || n < 1 || n > a.cfg.MaxRetentionHours {
+			return 0, false, &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter,
+				Msg: fmt.Sprintf("retention_hours must be between 1 and %d", a.cfg.MaxRetentionHours)}
+		}
+	}
+
+	var burn bool
+	if deleteAfterDownload = strings.TrimSpace(deleteAfterDownload); deleteAfterDownload != "" {
+		var err error
+		burn, err = strconv.ParseBool(deleteAfterDownload)
+		if err != nil {
+			return 0, false, &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter,
+				Msg: "delete_after_download must be true or false"}
+		}
+	}
+	return n, burn, nil
+}
+
+// validateUpload checks the operation, size and input format of one file
+// and resolves its parameters from the request's parameter fields. detected
+// is the format sniffed from the file's content, if any.
+func (a *app) validateUpload(op, filename, detected string, size int64, fields map[string]string) (models.JobParams, error) {
+	spec := operation.Get(op)
+	if spec == nil {
+		return models.JobParams{}, invalidOperation(op)
+	}
+
+	if size > a.cfg.MaxFileSize {
+		return models.JobParams{}, newAPIError(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("File too large (%s). Maximum: %s",
+				formatBytes(size), formatBytes(a.cfg.MaxFileSize)))
+	}
+
+	if size == 0 {
+		return models.JobParams{}, &apiError{Status: http.StatusBadRequest, Code: errcode.EmptyInput, Msg: "File is empty"}
+	}
+
+	inputExt, err := inputFormat(spec, filename, detected)
+	if err != nil {
+		return models.JobParams{}, err
+	}
+
+	if out, ok := fields["output_format"]; ok {
+		fields = maps.Clone(fields)
+		fields["output_format"] = normalizeExt(strings.TrimSpace(out))
+	}
+
+	params, err := spec.Resolve(fields, inputExt)
+	if err != nil {
+		return params, &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter, Msg: err.Error()}
+	}
+	return params, nil
+}
+
+// inputFormat reconciles the extension of filename with the format sniffed
+// from its content. Content wins: a renamed or extensionless file is
+// treated as what it really is, and content the operation cannot take is
+// rejected whatever the name says. The extension is only trusted when the
+// content matched no signature, or when it refines a container family the
+// content was matched to, like .m4a for a generic mp4.
+func inputFormat(spec *operation.Spec, filename, detected string) (string, error) {
+	ext := normalizeExt(filepath.Ext(filename))
+	if sniff.Refines(detected, ext) {
+		detected = ext
+	}
+
+	if detected == "" {
+		if !spec.ValidInput(ext) {
+			return "", &apiError{Status: http.StatusBadRequest, Code: errcode.UnsupportedFormat,
+				Msg: fmt.Sprintf("Unsupported input format .%s for %s", ext, spec.Name)}
+		}
+		return ext, nil
+	}
+
+	if !spec.ValidInput(detected) {
+		return "", newAPIError(http.StatusUnsupportedMediaType,
+			fmt.Sprintf("File content is %s, which %s does not accept", detected, spec.Name))
+	}
+	return detected, nil
+}
+
+// precheckUpload rejects a file before it is read when the operation field
+// arrived first and does not accept the file's format. Full validation
+// still happens once the whole form has been read.
+func (a *app) precheckUpload(values url.Values, filename, detected string) error {
+	op := strings.TrimSpace(values.Get("operation"))
+	if op == "" {
+		return nil
+	}
+	spec := operation.Get(op)
+	if spec == nil {
+		return invalidOperation(op)
+	}
+	_, err := inputFormat(spec, filename, detected)
+	return err
+}
+
+// ingestJob encrypts src into storage under a new job ID, then creates the
+// job as createStoredJob does. It reports whether the result came from the
+// cache.
+func (a *app) ingestJob(ctx context.Context, session *models.Session, spec uploadSpec, src io.Reader) (*models.Job, bool, error) {
+	jobID := uuid.New().String()
+
+	inputHash, err := a.storeInput(jobID, session.ID, src)
+	if err != nil {
+		log.Printf("[upload] store input error: %v", err)
+		return nil, false, &apiError{Status: http.StatusInternalServerError, Msg: "Failed to process upload", Err: err}
+	}
+
+	return a.createStoredJob(ctx, session, jobID, spec, inputHash)
+}
+
+// storeInput encrypts src into the input file of jobID and returns the keyed
+// hash of the plaintext used by the result cache.
+func (a *app) storeInput(jobID, sessionID string, src io.Reader) ([]byte, error) {
+	key, err := filecrypto.DeriveKey(a.cfg.MasterKey, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+
+	hasher, err := filecrypto.InputHasher(a.cfg.MasterKey, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("input hasher: %w", err)
+	}
+
+	dstFile, err := a.store.CreateInput(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	encErr := filecrypto.EncryptStream(key, io.TeeReader(src, hasher), dstFile)
+	syncErr := dstFile.Sync()
+	dstFile.Close()
+
+	if err := errors.Join(encErr, syncErr); err != nil {
+		a.store.DeleteInput(jobID)
+		return nil, fmt.Errorf("encrypt input %s: %w", jobID, err)
+	}
+	return hasher.Sum(nil), nil
+}
+
+// retentionHours returns the requested retention, or the default when none
+// was asked for.
+func (a *app) retentionHours(requested int) int {
+	if requested > 0 {
+		return requested
+	}
+	return a.cfg.FileRetentionHours
+}
+
+// createStoredJob creates the job row for an input that is already in
+// storage, then either completes it from the result cache or enqueues it.
+// The input is removed if the job cannot be created.
+func (a *app) createStoredJob(ctx context.Context, session *models.Session, jobID string, spec uploadSpec, inputHash []byte) (*models.Job, bool, error) {
+	job, err := a.db.CreateJob(ctx, database.CreateJobParams{
+		ID:             jobID,
+		SessionID:      session.ID,
+		Operation:      spec.Operation,
+		OriginalName:   spec.OriginalName,
+		DetectedFormat: spec.DetectedFormat,
+		InputSize:      spec.Size,
+		Params:         spec.Params,
+		BatchID:        spec.BatchID,
+		IdempotencyKey: spec.IdempotencyKey,
+		APIKeyID:       spec.APIKeyID,
+		CallbackURL:    spec.CallbackURL,
+		Steps:          spec.Steps,
+
+		DeleteAfterDownload: spec.DeleteAfterDownload,
+	}, a.retentionHours(spec.RetentionHours))
+	if err != nil {
+		a.store.DeleteJobFiles(jobID)
+		if errors.Is(err, database.ErrIdempotencyConflict) {
+			return nil, false, err
+		}
+		log.Printf("[upload] create job error: %v", err)
+		return nil, false, &apiError{Status: http.StatusInternalServerError, Msg: "Failed to create job", Err: err}
+	}
+
+	// The cache matches on the final parameters only, which do not
+	// identify a pipeline's result.
+	if len(spec.Steps) == 0 {
+		if done, ok := a.completeFromCache(ctx, job, spec.Params, inputHash); ok {
+			return done, true, nil
+		}
+	}
+
+	if err := a.db.SetJobInputHash(ctx, job.ID, inputHash); err != nil {
+		log.Printf("[upload] store input hash error: %v", err)
+	}
+
+	enqueue := a.queue.Enqueue
+	if spec.Priority {
+		enqueue = a.queue.EnqueuePriority
+	}
+	if err := enqueue(ctx, job.ID); err != nil {
+		log.Printf("[upload] enqueue error: %v", err)
+		a.db.DeleteJob(ctx, job.ID)
+		a.store.DeleteJobFiles(job.ID)
+		return nil, false, &apiError{Status: http.StatusInternalServerError, Msg: "Failed to queue job", Err: err}
+	}
+
+	log.Printf("[upload] Job %s created: %s %s (%s)",
+		job.ID, spec.Operation, spec.OriginalName, formatBytes(spec.Size))
+
+	return job, false, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileforge/internal/database"
+	"fileforge/internal/models"
+	"fileforge/internal/operation"
+)
+
+const (
+	defaultJobPageSize = 20
+	maxJobPageSize     = 100
+)
+
+// jobSorts are the accepted values of ?sort=; a leading "-" means
+// descending.
+var jobSorts = []string{"-created_at", "created_at", "-input_size", "input_size"}
+
+// handleListJobs lists the caller's jobs, newest first by default. Pages are
+// linked by an opaque cursor rather than an offset, so jobs created while a
+// client is paging neither repeat nor go missing.
+func (a *app) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return
+	}
+
+	q := r.URL.Query()
+	f := database.SessionJobFilter{
+		SessionID: session.ID,
+		Status:    q.Get("status"),
+		Operation: q.Get("operation"),
+		Limit:     defaultJobPageSize,
+	}
+
+	switch f.Status {
+	case "", models.StatusPending, models.StatusProcessing, models.StatusCompleted, models.StatusFailed:
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid status filter")
+		return
+	}
+	if f.Operation != "" && f.Operation != models.OperationPipeline && operation.Get(f.Operation) == nil {
+		writeError(w, http.StatusBadRequest, "Invalid operation filter")
+		return
+	}
+
+	sort := q.Get("sort")
+	if sort == "" {
+		sort = jobSorts[0]
+	}
+	if !slices.Contains(jobSorts, sort) {
+		writeError(w, http.StatusBadRequest, "sort must be one of "+strings.Join(jobSorts, ", "))
+		return
+	}
+	f.SortBy, f.Desc = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxJobPageSize {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxJobPageSize))
+			return
+		}
+		f.Limit = n
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		var err error
+		f.AfterValue, f.AfterID, err = decodeJobCursor(c, sort)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+	}
+
+	// One extra row tells whether there is a next page.
+	f.Limit++
+	jobs, err := a.db.ListSessionJobs(ctx, f)
+	if err != nil {
+		log.Printf("[jobs] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	counts, err := a.db.CountSessionJobs(ctx, session.ID, f.Operation)
+	if err != nil {
+		log.Printf("[jobs] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	resp := models.JobListResponse{
+		Jobs:   make([]models.JobResponse, 0, len(jobs)),
+		Counts: counts,
+	}
+	for _, n := range counts {
+		resp.Total += n
+	}
+	if len(jobs) == f.Limit {
+		jobs = jobs[:len(jobs)-1]
+		resp.NextCursor = encodeJobCursor(sort, jobs[len(jobs)-1])
+	}
+	for _, j := range jobs {
+		resp.Jobs = append(resp.Jobs, j.ToResponse())
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// A cursor is the sort it belongs to plus the sort value and id of the last
+// job on the page, base64url-encoded.
+func encodeJobCursor(sort string, j *models.Job) string {
+	var value string
+	switch strings.TrimPrefix(sort, "-") {
+	case "created_at":
+		value = j.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "input_size":
+		value = strconv.FormatInt(j.InputSize, 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(sort + "|" + value + "|" + j.ID))
+}
+
+func decodeJobCursor(cursor, sort string) (interface{}, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || parts[0] != sort || !isValidUUID(parts[2]) {
+		return nil, "", fmt.Errorf("cursor does not belong to sort %s", sort)
+	}
+
+	var value interface{}
+	switch strings.TrimPrefix(sort, "-") {
+	case "created_at":
+		value, err = time.Parse(time.RFC3339Nano, parts[1])
+	case "input_size":
+		value, err = strconv.ParseInt(parts[1], 10, 64)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return value, parts[2], nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,19 +13,49 @@ import (
 	"time"
 
 	"fileforge/internal/config"
+	filecrypto "fileforge/internal/crypto"
 	"fileforge/internal/database"
+	"fileforge/internal/fetch"
 	"fileforge/internal/queue"
 	"fileforge/internal/storage"
+	"fileforge/internal/webhook"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+// webhookRetention is how long finished webhook deliveries stay replayable.
+const webhookRetention = 7 * 24 * time.Hour
+
+// adminAuditRetention is how long admin audit log entries are kept.
+const adminAuditRetention = 90 * 24 * time.Hour
+
+// strayInputAge is how long an input file may go without a job or upload
+// row before cleanup removes it. Streamed forms store inputs before the
+// row is created, so it must stay well above the server's ReadTimeout.
+const strayInputAge = time.Hour
+
 type app struct {
 	cfg   *config.Config
 	db    *database.DB
 	queue *queue.Queue
 	store *storage.Storage
+
+	powKey     []byte
+	shareKey   []byte
+	receiptKey []byte
+	fetcher    *fetch.Fetcher
+	notifier   *webhook.Notifier
+
+	// syncSlots bounds concurrent POST /api/convert requests, each of which
+	// holds a Redis connection while it waits for its job.
+	syncSlots chan struct{}
+
+	anonAudits anonAudit
+
+	// openapi is the encoded document served at /api/openapi.json, built
+	// from the router at startup.
+	openapi []byte
 }
 
 func main() {
@@ -55,15 +87,52 @@ func main() {
 	}
 	log.Printf("Storage ready at %s", cfg.StoragePath)
 
+	powKey, err := filecrypto.DeriveSubkey(cfg.MasterKey, "pow-challenge")
+	if err != nil {
+		log.Fatalf("Key derivation error: %v", err)
+	}
+
+	shareKey, err := filecrypto.DeriveSubkey(cfg.MasterKey, "share-link")
+	if err != nil {
+		log.Fatalf("Key derivation error: %v", err)
+	}
+
+	receiptKey, err := filecrypto.DeriveSubkey(cfg.MasterKey, "erasure-receipt")
+	if err != nil {
+		log.Fatalf("Key derivation error: %v", err)
+	}
+
 	a := &app{
-		cfg:   cfg,
-		db:    db,
-		queue: q,
-		store: store,
+		cfg:        cfg,
+		db:         db,
+		queue:      q,
+		store:      store,
+		powKey:     powKey,
+		shareKey:   shareKey,
+		receiptKey: receiptKey,
+		notifier: &webhook.Notifier{
+			DB:            db,
+			ShareKey:      shareKey,
+			PublicBaseURL: cfg.PublicBaseURL,
+		},
+		syncSlots: make(chan struct{}, max(cfg.SyncMaxConcurrent, 0)),
+	}
+
+	if cfg.URLImportEnabled {
+		a.fetcher = fetch.New(fetch.Options{
+			MaxSize:      cfg.MaxFileSize,
+			Timeout:      cfg.URLImportTimeout,
+			MaxRedirects: cfg.URLImportMaxRedirects,
+		})
 	}
 
 	r := a.buildRouter()
 
+	a.openapi, err = buildOpenAPI(r)
+	if err != nil {
+		log.Fatalf("OpenAPI error: %v", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go a.startCleanup(ctx)
@@ -88,6 +157,21 @@ func main() {
 		}
 	}()
 
+	var adminSrv *http.Server
+	if cfg.AdminMTLSEnabled() {
+		adminSrv, err = a.adminTLSServer(a.buildAdminRouter())
+		if err != nil {
+			log.Fatalf("Admin TLS error: %v", err)
+		}
+		go func() {
+			log.Printf("Admin mTLS listener on :%d", cfg.AdminTLSPort)
+			err := adminSrv.ListenAndServeTLS(cfg.AdminTLSCertFile, cfg.AdminTLSKeyFile)
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Admin server error: %v", err)
+			}
+		}()
+	}
+
 	<-done
 	log.Println("Shutting down API server...")
 	cancel()
@@ -95,6 +179,9 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
+	if adminSrv != nil {
+		adminSrv.Shutdown(shutdownCtx)
+	}
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Fatalf("Shutdown error: %v", err)
 	}
@@ -113,21 +200,114 @@ func (a *app) buildRouter() chi.Router {
 	r.Route("/api", func(r chi.Router) {
 		r.Get("/health", a.handleHealth)
 		r.Get("/formats", a.handleFormats)
-		r.Get("/admin/stats", a.handleAdminStats)
+		r.Get("/errors", a.handleErrorCodes)
+		r.Get("/openapi.json", a.handleOpenAPI)
+		r.Post("/challenge", a.handleRedeemChallenge)
+		r.Options("/uploads", a.handleUploadOptions)
+		r.Get("/s/{token}", a.handleSharedDownload)
+
+		r.Route("/admin", a.adminRoutes)
 
 		r.Group(func(r chi.Router) {
 			r.Use(a.sessionMiddleware)
 
+			r.Get("/jobs", a.handleListJobs)
 			r.Post("/jobs", a.handleCreateJob)
+			r.Post("/convert", a.handleConvert)
+			r.Post("/probe", a.handleProbe)
 			r.Get("/jobs/{id}", a.handleGetJob)
 			r.Get("/jobs/{id}/download", a.handleDownload)
+			r.Patch("/jobs/{id}", a.handleUpdateJob)
 			r.Delete("/jobs/{id}", a.handleDeleteJob)
+			r.Post("/jobs/{id}/share", a.handleCreateShare)
+			r.Get("/jobs/{id}/shares", a.handleListShares)
+			r.Delete("/jobs/{id}/shares/{linkID}", a.handleRevokeShare)
+
+			r.Post("/batches", a.handleCreateBatch)
+			r.Get("/batches/{id}", a.handleGetBatch)
+			r.Delete("/batches/{id}", a.handleDeleteBatch)
+			r.Get("/batches/{id}/download.zip", a.handleBatchZip)
+
+			r.Get("/presets", a.handleListPresets)
+			r.Post("/presets", a.handleCreatePreset)
+			r.Delete("/presets/{name}", a.handleDeletePreset)
+
+			r.Get("/session", a.handleGetSession)
+			r.Delete("/session", a.handleEraseSession)
+			r.Get("/session/download.zip", a.handleSessionZip)
+
+			r.With(tusResumable).Post("/uploads", a.handleCreateUpload)
+			r.With(tusResumable).Head("/uploads/{id}", a.handleUploadHead)
+			r.With(tusResumable).Patch("/uploads/{id}", a.handleUploadPatch)
+			r.With(tusResumable).Delete("/uploads/{id}", a.handleUploadDelete)
 		})
 	})
 
 	return r
 }
 
+func (a *app) adminRoutes(r chi.Router) {
+	r.Use(a.adminMiddleware)
+
+	r.Get("/stats", a.handleAdminStats)
+	r.Get("/jobs", a.handleAdminListJobs)
+	r.Post("/jobs/{id}/expire", a.handleAdminExpireJob)
+	r.Post("/jobs/{id}/retry", a.handleAdminRetryJob)
+	r.Get("/sessions", a.handleAdminListSessions)
+	r.Post("/ips/{ip}/unflag", a.handleAdminUnflagIP)
+	r.Get("/queue", a.handleAdminQueue)
+	r.Get("/audit", a.handleAdminAudit)
+
+	r.Get("/api-keys", a.handleAdminListAPIKeys)
+	r.Post("/api-keys", a.handleAdminCreateAPIKey)
+	r.Delete("/api-keys/{id}", a.handleAdminRevokeAPIKey)
+	r.Post("/api-keys/{id}/webhook-secret", a.handleAdminSetWebhookSecret)
+
+	r.Get("/webhooks", a.handleAdminListWebhooks)
+	r.Post("/webhooks/{id}/replay", a.handleAdminReplayWebhook)
+}
+
+// buildAdminRouter serves only the admin API, for the mTLS listener. Clients
+// connect to it directly, so forwarding headers are not trusted.
+func (a *app) buildAdminRouter() chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middleware.RequestID)
+	r.Use(middleware.Logger)
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.Compress(5))
+
+	r.Route("/api/admin", a.adminRoutes)
+	return r
+}
+
+// adminTLSServer serves the admin API on a separate port that requires a
+// client certificate signed by ADMIN_CLIENT_CA_FILE.
+func (a *app) adminTLSServer(h http.Handler) (*http.Server, error) {
+	caPEM, err := os.ReadFile(a.cfg.AdminClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", a.cfg.AdminClientCAFile)
+	}
+
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", a.cfg.AdminTLSPort),
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      time.Minute,
+		IdleTimeout:       120 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+		},
+	}, nil
+}
+
 func (a *app) startCleanup(ctx context.Context) {
 	interval := time.Duration(a.cfg.CleanupIntervalMin) * time.Minute
 	ticker := time.NewTicker(interval)
@@ -162,10 +342,82 @@ func (a *app) runCleanup() {
 		log.Printf("[cleanup] Removed %d expired jobs + files", len(ids))
 	}
 
+	uploadIDs, err := a.db.CleanupExpiredUploads(ctx)
+	if err != nil {
+		log.Printf("[cleanup] expired uploads error: %v", err)
+	} else if len(uploadIDs) > 0 {
+		for _, id := range uploadIDs {
+			a.store.DeleteUploadFiles(id)
+		}
+		log.Printf("[cleanup] Removed %d abandoned uploads", len(uploadIDs))
+	}
+
+	a.cleanupStrayInputs(ctx)
+
+	if n, err := a.db.CleanupExpiredBatches(ctx); err != nil {
+		log.Printf("[cleanup] expired batches error: %v", err)
+	} else if n > 0 {
+		log.Printf("[cleanup] Removed %d expired batches", n)
+	}
+
 	n, err := a.db.ResetHourlyCounts(ctx)
 	if err != nil {
 		log.Printf("[cleanup] reset hourly counts error: %v", err)
 	} else if n > 0 {
 		log.Printf("[cleanup] Reset hourly counts for %d sessions", n)
 	}
+
+	if n, err := a.db.CleanupExpiredShareLinks(ctx); err != nil {
+		log.Printf("[cleanup] share links error: %v", err)
+	} else if n > 0 {
+		log.Printf("[cleanup] Removed %d expired share links", n)
+	}
+
+	if n, err := a.db.CleanupWebhookDeliveries(ctx, webhookRetention); err != nil {
+		log.Printf("[cleanup] webhook deliveries error: %v", err)
+	} else if n > 0 {
+		log.Printf("[cleanup] Removed %d old webhook deliveries", n)
+	}
+
+	if _, err := a.db.CleanupRedemptions(ctx); err != nil {
+		log.Printf("[cleanup] challenge redemptions error: %v", err)
+	}
+
+	if n, err := a.db.CleanupAdminAudit(ctx, adminAuditRetention); err != nil {
+		log.Printf("[cleanup] admin audit log error: %v", err)
+	} else if n > 0 {
+		log.Printf("[cleanup] Removed %d old admin audit entries", n)
+	}
+}
+
+// cleanupStrayInputs removes inputs left behind by requests that died
+// between storing a file and creating its job row.
+func (a *app) cleanupStrayInputs(ctx context.Context) {
+	names, err := a.store.InputsOlderThan(time.Now().Add(-strayInputAge))
+	if err != nil {
+		log.Printf("[cleanup] list inputs error: %v", err)
+		return
+	}
+
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		if isValidUUID(name) {
+			ids = append(ids, name)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	orphans, err := a.db.OrphanedInputs(ctx, ids)
+	if err != nil {
+		log.Printf("[cleanup] stray inputs error: %v", err)
+		return
+	}
+	for _, id := range orphans {
+		a.store.DeleteInput(id)
+	}
+	if len(orphans) > 0 {
+		log.Printf("[cleanup] Removed %d stray input files", len(orphans))
+	}
 }
\ No newline at end of file
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 
+	"fileforge/internal/errcode"
 	"fileforge/internal/models"
 )
 
@@ -35,21 +36,15 @@ func (a *app) sessionMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		if session.IsFlagged {
-			log.Printf("[session] Blocked flagged IP: %s (total: %d)",
-				ip, session.TotalRequestCount)
-			writeError(w, http.StatusForbidden,
-				"Access restricted. Too many requests from this IP.")
-			return
+		if session.IsFlagged || session.HourlyRequestCount > a.cfg.RateLimitPerHour {
+			if !a.consumeAllowance(r, session) {
+				a.rejectSession(w, ip, session)
+				return
+			}
 		}
 
-		if session.HourlyRequestCount > a.cfg.RateLimitPerHour {
-			log.Printf("[session] Rate limited: %s (%d/%d this hour)",
-				ip, session.HourlyRequestCount, a.cfg.RateLimitPerHour)
-
-			w.Header().Set("Retry-After", "3600")
-			writeError(w, http.StatusTooManyRequests,
-				"Rate limit exceeded. Please try again later.")
+		r, ok := a.withAPIKey(w, r)
+		if !ok {
 			return
 		}
 
@@ -89,5 +84,9 @@ func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 }
 
 func writeError(w http.ResponseWriter, status int, msg string) {
-	writeJSON(w, status, models.ErrorResponse{Error: msg})
+	writeErrorCode(w, status, errcode.ForStatus(status), msg)
+}
+
+func writeErrorCode(w http.ResponseWriter, status int, code errcode.Code, msg string) {
+	writeJSON(w, status, models.ErrorResponse{Code: string(code), Error: msg})
 }
\ No newline at end of file
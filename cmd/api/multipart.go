@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"fileforge/internal/sniff"
+
+	"github.com/google/uuid"
+)
+
+// maxFormFieldBytes caps the combined size of all non-file form fields.
+const maxFormFieldBytes = 1 << 20
+
+var errPartTooLarge = errors.New("part exceeds size limit")
+
+// streamedFile is a "file" part that has already been encrypted into storage
+// under a pre-generated job ID. The job row is created only after the whole
+// form has been read and validated.
+type streamedFile struct {
+	JobID    string
+	Filename string
+	Size     int64
+	Hash     []byte
+	// Format is the format sniffed from the leading bytes, or "" if they
+	// matched no known signature.
+	Format string
+}
+
+type streamedForm struct {
+	Values url.Values
+	Files  []*streamedFile
+}
+
+func (f *streamedForm) Get(key string) string {
+	return f.Values.Get(key)
+}
+
+type formLimits struct {
+	MaxFiles     int
+	MaxFileSize  int64
+	MaxTotalSize int64
+}
+
+// readStreamedForm reads a multipart body part by part. File parts named
+// "file" go straight through encryption into storage, so no plaintext ever
+// touches the API's disk; size limits are enforced as the bytes arrive.
+// Other fields may appear before or after the files. precheck, if set, runs
+// before each file is stored with the fields seen so far and the format
+// sniffed from the file's first bytes, so obviously bad requests are
+// rejected without reading the rest of the file.
+func (a *app) readStreamedForm(r *http.Request, sessionID string, limits formLimits, precheck func(values url.Values, filename, detected string) error) (*streamedForm, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "Invalid form data")
+	}
+
+	form := &streamedForm{Values: make(url.Values)}
+	fail := func(err error) (*streamedForm, error) {
+		a.discardStreamed(form.Files)
+		return nil, err
+	}
+
+	var fieldBytes, totalBytes int64
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(formReadError(err))
+		}
+
+		name := part.FormName()
+		filename := part.FileName()
+
+		switch {
+		case filename == "":
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldBytes-fieldBytes+1))
+			if err != nil {
+				return fail(formReadError(err))
+			}
+			fieldBytes += int64(len(value))
+			if fieldBytes > maxFormFieldBytes {
+				return fail(newAPIError(http.StatusRequestEntityTooLarge, "Form fields too large"))
+			}
+			form.Values.Add(name, string(value))
+
+		case name != "file":
+			if _, err := io.Copy(io.Discard, part); err != nil {
+				return fail(formReadError(err))
+			}
+
+		default:
+			if len(form.Files) >= limits.MaxFiles {
+				return fail(newAPIError(http.StatusBadRequest,
+					fmt.Sprintf("Too many files. Maximum: %d", limits.MaxFiles)))
+			}
+
+			body, detected, err := sniff.Reader(part)
+			if err != nil {
+				return fail(formReadError(err))
+			}
+			if precheck != nil {
+				if err := precheck(form.Values, filename, detected); err != nil {
+					return fail(err)
+				}
+			}
+
+			limit := limits.MaxFileSize
+			tooLarge := newAPIError(http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("File too large. Maximum: %s", formatBytes(limits.MaxFileSize)))
+			if rest := limits.MaxTotalSize - totalBytes; rest < limit {
+				limit = rest
+				tooLarge = newAPIError(http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("Upload too large. Maximum: %s", formatBytes(limits.MaxTotalSize)))
+			}
+
+			f := &streamedFile{JobID: uuid.New().String(), Filename: filename, Format: detected}
+			form.Files = append(form.Files, f)
+
+			src := &limitedPartReader{r: body, max: limit}
+			hash, err := a.storeInput(f.JobID, sessionID, src)
+			switch {
+			case errors.Is(src.err, errPartTooLarge):
+				return fail(tooLarge)
+			case src.err != nil:
+				return fail(formReadError(src.err))
+			case err != nil:
+				log.Printf("[upload] store input error: %v", err)
+				return fail(&apiError{Status: http.StatusInternalServerError, Msg: "Failed to process upload", Err: err})
+			}
+
+			f.Size = src.n
+			f.Hash = hash
+			totalBytes += f.Size
+		}
+	}
+
+	return form, nil
+}
+
+// discardStreamed removes stored inputs that never became jobs.
+func (a *app) discardStreamed(files []*streamedFile) {
+	for _, f := range files {
+		a.store.DeleteJobFiles(f.JobID)
+	}
+}
+
+func formReadError(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return newAPIError(http.StatusRequestEntityTooLarge, "Request body too large")
+	}
+	return &apiError{Status: http.StatusBadRequest, Msg: "Invalid form data", Err: err}
+}
+
+// limitedPartReader counts the bytes of one part, fails once max is exceeded
+// and remembers any read error other than EOF, so a truncated body is never
+// mistaken for the end of the file.
+type limitedPartReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+	err error
+}
+
+func (l *limitedPartReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.max {
+		l.err = errPartTooLarge
+		return n, l.err
+	}
+	if err != nil && err != io.EOF {
+		l.err = err
+	}
+	return n, err
+}
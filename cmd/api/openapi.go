@@ -0,0 +1,704 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"fileforge/internal/errcode"
+	"fileforge/internal/models"
+	"fileforge/internal/operation"
+	"fileforge/internal/probe"
+	"fileforge/internal/queue"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// The OpenAPI document is generated at startup: paths, methods, path
+// parameters and authentication come from walking the router, request and
+// response schemas from the Go types the handlers encode. routeDocs only
+// adds what the router cannot know.
+
+// routeDoc describes one route. Responses maps a success status to a value
+// of the type written with that status, nil for an empty body, or fileBody
+// when the output file itself is returned. Every route also documents
+// models.ErrorResponse as its default response.
+type routeDoc struct {
+	Summary   string
+	Tag       string
+	Query     []string
+	Headers   []string
+	Body      any
+	Responses map[int]any
+}
+
+// formBody selects one of the multipart forms accepted by the upload routes.
+type formBody int
+
+const (
+	jobForm formBody = iota + 1
+	convertForm
+	probeForm
+	batchForm
+)
+
+// rawBody is a request body that is sent as-is with the given content type.
+type rawBody string
+
+type fileBody struct{}
+
+type statusResponse struct {
+	Status string `json:"status"`
+	ID     string `json:"id"`
+}
+
+type listMeta struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+var routeDocs = map[string]routeDoc{
+	"GET /api/health": {
+		Summary: "Report database and Redis connectivity", Tag: "meta",
+		Responses: map[int]any{
+			200: struct {
+				Status  string `json:"status"`
+				Service string `json:"service"`
+			}{},
+			503: struct {
+				Status   string `json:"status"`
+				Database string `json:"database"`
+				Redis    string `json:"redis"`
+			}{},
+		},
+	},
+	"GET /api/formats": {
+		Summary: "List operations with their formats and parameters", Tag: "meta",
+		Responses: map[int]any{200: map[string]operation.Format{}},
+	},
+	"GET /api/errors": {
+		Summary: "List the error codes of error responses and failed jobs", Tag: "meta",
+		Responses: map[int]any{200: []errcode.Entry{}},
+	},
+	"GET /api/openapi.json": {
+		Summary: "This document", Tag: "meta",
+		Responses: map[int]any{200: map[string]any{}},
+	},
+	"POST /api/challenge": {
+		Summary: "Redeem a solved proof-of-work challenge for extra requests", Tag: "meta",
+		Body: models.ChallengeSolution{},
+		Responses: map[int]any{200: struct {
+			Status            string `json:"status"`
+			AllowanceRequests int    `json:"allowance_requests"`
+			AllowanceSeconds  int    `json:"allowance_seconds"`
+		}{}},
+	},
+	"GET /api/s/{token}": {
+		Summary: "Download a shared job output", Tag: "shares",
+		Responses: map[int]any{200: fileBody{}},
+	},
+
+	"GET /api/jobs": {
+		Summary: "List the session's jobs with status counts", Tag: "jobs",
+		Query:     []string{"status", "operation", "sort", "limit", "cursor"},
+		Responses: map[int]any{200: models.JobListResponse{}},
+	},
+	"POST /api/jobs": {
+		Summary: "Create a job from an uploaded file or a source URL", Tag: "jobs",
+		Headers:   []string{"Idempotency-Key"},
+		Body:      jobForm,
+		Responses: map[int]any{201: models.JobResponse{}},
+	},
+	"POST /api/convert": {
+		Summary: "Convert a small file and return the result in the response", Tag: "jobs",
+		Body:      convertForm,
+		Responses: map[int]any{200: fileBody{}, 202: models.JobResponse{}},
+	},
+	"POST /api/probe": {
+		Summary: "Return the metadata of an uploaded file", Tag: "jobs",
+		Body:      probeForm,
+		Responses: map[int]any{200: probe.Result{}, 202: models.JobResponse{}},
+	},
+	"GET /api/jobs/{id}": {
+		Summary: "Get a job's status", Tag: "jobs",
+		Responses: map[int]any{200: models.JobResponse{}},
+	},
+	"GET /api/jobs/{id}/download": {
+		Summary: "Download a completed job's output", Tag: "jobs",
+		Responses: map[int]any{200: fileBody{}},
+	},
+	"PATCH /api/jobs/{id}": {
+		Summary: "Change how long a job is kept", Tag: "jobs",
+		Body:      models.UpdateJobRequest{},
+		Responses: map[int]any{200: models.JobResponse{}},
+	},
+	"DELETE /api/jobs/{id}": {
+		Summary: "Delete a job and its files", Tag: "jobs",
+		Responses: map[int]any{200: statusResponse{}},
+	},
+	"POST /api/jobs/{id}/share": {
+		Summary: "Create a share link for a completed job", Tag: "shares",
+		Body:      models.CreateShareRequest{},
+		Responses: map[int]any{201: models.ShareLinkResponse{}},
+	},
+	"GET /api/jobs/{id}/shares": {
+		Summary: "List a job's share links", Tag: "shares",
+		Responses: map[int]any{200: struct {
+			Links []models.ShareLinkResponse `json:"links"`
+		}{}},
+	},
+	"DELETE /api/jobs/{id}/shares/{linkID}": {
+		Summary: "Revoke a share link", Tag: "shares",
+		Responses: map[int]any{200: statusResponse{}},
+	},
+
+	"POST /api/batches": {
+		Summary: "Create a batch of jobs from several files", Tag: "batches",
+		Body:      batchForm,
+		Responses: map[int]any{201: models.BatchResponse{}},
+	},
+	"GET /api/batches/{id}": {
+		Summary: "Get a batch and the status of its jobs", Tag: "batches",
+		Responses: map[int]any{200: models.BatchResponse{}},
+	},
+	"DELETE /api/batches/{id}": {
+		Summary: "Delete a batch and all of its jobs", Tag: "batches",
+		Responses: map[int]any{200: struct {
+			statusResponse
+			JobsDeleted int `json:"jobs_deleted"`
+		}{}},
+	},
+	"GET /api/batches/{id}/download.zip": {
+		Summary: "Download the completed outputs of a batch as a ZIP archive", Tag: "batches",
+		Responses: map[int]any{200: fileBody{}},
+	},
+	"GET /api/presets": {
+		Summary: "List the built-in presets and the API key's own", Tag: "presets",
+		Responses: map[int]any{200: struct {
+			Presets []models.PresetResponse `json:"presets"`
+		}{}},
+	},
+	"POST /api/presets": {
+		Summary: "Create a preset for the API key", Tag: "presets",
+		Body:      models.CreatePresetRequest{},
+		Responses: map[int]any{201: models.PresetResponse{}},
+	},
+	"DELETE /api/presets/{name}": {
+		Summary: "Delete one of the API key's presets", Tag: "presets",
+		Responses: map[int]any{200: statusResponse{}},
+	},
+	"GET /api/session": {
+		Summary: "Export the session with its usage and job history", Tag: "session",
+		Responses: map[int]any{200: models.SessionExport{}},
+	},
+	"DELETE /api/session": {
+		Summary: "Erase the session, its jobs and files, and cancel running work", Tag: "session",
+		Responses: map[int]any{200: models.ErasureReceipt{}},
+	},
+	"GET /api/session/download.zip": {
+		Summary: "Download every completed output of the session as a ZIP archive", Tag: "jobs",
+		Responses: map[int]any{200: fileBody{}},
+	},
+
+	"OPTIONS /api/uploads": {
+		Summary: "Report the supported tus version, extensions and maximum size", Tag: "uploads",
+		Responses: map[int]any{204: nil},
+	},
+	"POST /api/uploads": {
+		Summary: "Start a resumable tus upload", Tag: "uploads",
+		Headers:   []string{"Tus-Resumable", "Upload-Length", "Upload-Metadata"},
+		Responses: map[int]any{201: nil},
+	},
+	"HEAD /api/uploads/{id}": {
+		Summary: "Get the current offset of an upload", Tag: "uploads",
+		Headers:   []string{"Tus-Resumable"},
+		Responses: map[int]any{200: nil},
+	},
+	"PATCH /api/uploads/{id}": {
+		Summary: "Append a chunk; the final chunk creates the job named in X-Job-ID", Tag: "uploads",
+		Headers:   []string{"Tus-Resumable", "Upload-Offset"},
+		Body:      rawBody("application/offset+octet-stream"),
+		Responses: map[int]any{204: nil},
+	},
+	"DELETE /api/uploads/{id}": {
+		Summary: "Abort an upload", Tag: "uploads",
+		Headers:   []string{"Tus-Resumable"},
+		Responses: map[int]any{204: nil},
+	},
+
+	"GET /api/admin/stats": {
+		Summary: "Queue, job and storage statistics", Tag: "admin",
+		Responses: map[int]any{200: models.AdminStats{}},
+	},
+	"GET /api/admin/jobs": {
+		Summary: "List jobs", Tag: "admin",
+		Query: []string{"status", "operation", "session_id", "limit", "offset"},
+		Responses: map[int]any{200: struct {
+			Jobs []models.AdminJobResponse `json:"jobs"`
+			listMeta
+		}{}},
+	},
+	"POST /api/admin/jobs/{id}/expire": {
+		Summary: "Delete a job and its files immediately", Tag: "admin",
+		Responses: map[int]any{200: statusResponse{}},
+	},
+	"POST /api/admin/jobs/{id}/retry": {
+		Summary: "Requeue a failed or stuck job", Tag: "admin",
+		Responses: map[int]any{202: models.AdminJobResponse{}},
+	},
+	"GET /api/admin/sessions": {
+		Summary: "List sessions", Tag: "admin",
+		Query: []string{"flagged", "limit", "offset"},
+		Responses: map[int]any{200: struct {
+			Sessions []models.Session `json:"sessions"`
+			listMeta
+		}{}},
+	},
+	"POST /api/admin/ips/{ip}/unflag": {
+		Summary: "Clear the abuse flag of an IP address", Tag: "admin",
+		Responses: map[int]any{200: struct {
+			Status string `json:"status"`
+			IP     string `json:"ip"`
+		}{}},
+	},
+	"GET /api/admin/queue": {
+		Summary: "Show the length and head of each queue lane", Tag: "admin",
+		Responses: map[int]any{200: struct {
+			Lanes []queue.LaneInfo `json:"lanes"`
+		}{}},
+	},
+	"GET /api/admin/audit": {
+		Summary: "List admin audit log entries", Tag: "admin",
+		Query: []string{"limit", "offset"},
+		Responses: map[int]any{200: struct {
+			Entries []models.AdminAuditEntry `json:"entries"`
+			listMeta
+		}{}},
+	},
+	"GET /api/admin/api-keys": {
+		Summary: "List API keys", Tag: "admin",
+		Responses: map[int]any{200: struct {
+			APIKeys []models.APIKeyResponse `json:"api_keys"`
+		}{}},
+	},
+	"POST /api/admin/api-keys": {
+		Summary: "Create an API key; the key is only returned here", Tag: "admin",
+		Body:      apiKeyRequest{},
+		Responses: map[int]any{201: models.APIKeyResponse{}},
+	},
+	"DELETE /api/admin/api-keys/{id}": {
+		Summary: "Revoke an API key", Tag: "admin",
+		Responses: map[int]any{200: statusResponse{}},
+	},
+	"POST /api/admin/api-keys/{id}/webhook-secret": {
+		Summary: "Set or rotate the webhook signing secret of an API key", Tag: "admin",
+		Body:      apiKeyRequest{},
+		Responses: map[int]any{200: models.APIKeyResponse{}},
+	},
+	"GET /api/admin/webhooks": {
+		Summary: "List webhook deliveries", Tag: "admin",
+		Query: []string{"status", "job_id", "limit", "offset"},
+		Responses: map[int]any{200: struct {
+			Deliveries []models.WebhookDelivery `json:"deliveries"`
+			listMeta
+		}{}},
+	},
+	"POST /api/admin/webhooks/{id}/replay": {
+		Summary: "Deliver a webhook again", Tag: "admin",
+		Responses: map[int]any{202: models.WebhookDelivery{}},
+	},
+}
+
+var queryParams = map[string]map[string]any{
+	"status":     {"type": "string"},
+	"operation":  {"type": "string", "enum": operation.Names()},
+	"session_id": {"type": "string", "format": "uuid"},
+	"job_id":     {"type": "string", "format": "uuid"},
+	"flagged":    {"type": "boolean"},
+	"limit":      {"type": "integer", "minimum": 1, "description": "Page size; the maximum depends on the endpoint."},
+	"offset":     {"type": "integer", "minimum": 0, "default": 0},
+	"sort":       {"type": "string", "enum": jobSorts, "default": jobSorts[0]},
+	"cursor":     {"type": "string", "description": "next_cursor of the previous page."},
+}
+
+var headerParams = map[string]string{
+	"Idempotency-Key": "Makes retries safe: a repeated request with the same key returns the job created by the first.",
+	"Tus-Resumable":   "tus protocol version, " + tusVersion + ".",
+	"Upload-Length":   "Total size of the upload in bytes.",
+	"Upload-Metadata": "Comma-separated key and base64 value pairs: filename, filetype, operation, retention_hours, delete_after_download and operation parameters.",
+	"Upload-Offset":   "Offset of this chunk, which must equal the current upload offset.",
+}
+
+var pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// buildOpenAPI walks the router and returns the encoded document.
+func buildOpenAPI(r chi.Routes) ([]byte, error) {
+	g := &schemaGen{components: map[string]any{}}
+
+	paths := map[string]map[string]any{}
+	err := chi.Walk(r, func(method, route string, handler http.Handler, mws ...func(http.Handler) http.Handler) error {
+		doc, ok := routeDocs[method+" "+route]
+		if !ok {
+			return fmt.Errorf("no OpenAPI description for %s %s", method, route)
+		}
+
+		op := map[string]any{
+			"operationId": operationID(handler),
+			"summary":     doc.Summary,
+			"tags":        []string{doc.Tag},
+			"responses":   g.responses(doc.Responses),
+		}
+
+		var params []any
+		for _, m := range pathParamPattern.FindAllStringSubmatch(route, -1) {
+			schema := map[string]any{"type": "string"}
+			if m[1] == "id" || strings.HasSuffix(m[1], "ID") {
+				schema["format"] = "uuid"
+			}
+			params = append(params, map[string]any{"name": m[1], "in": "path", "required": true, "schema": schema})
+		}
+		for _, name := range doc.Query {
+			params = append(params, map[string]any{"name": name, "in": "query", "schema": queryParams[name]})
+		}
+		for _, name := range doc.Headers {
+			params = append(params, map[string]any{
+				"name":        name,
+				"in":          "header",
+				"required":    name != "Idempotency-Key",
+				"description": headerParams[name],
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if body := g.requestBody(doc.Body); body != nil {
+			op["requestBody"] = body
+		}
+
+		switch {
+		case strings.HasPrefix(route, "/api/admin/"):
+			op["security"] = []any{map[string]any{"adminToken": []string{}}}
+		case hasMiddleware(mws, "sessionMiddleware"):
+			// Sessions are keyed by client IP; an API key is optional.
+			op["security"] = []any{
+				map[string]any{},
+				map[string]any{"apiKey": []string{}},
+				map[string]any{"bearerAPIKey": []string{}},
+			}
+		}
+
+		if paths[route] == nil {
+			paths[route] = map[string]any{}
+		}
+		paths[route][strings.ToLower(method)] = op
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "FileForge API",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.components,
+			"securitySchemes": map[string]any{
+				"apiKey":       map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearerAPIKey": map[string]any{"type": "http", "scheme": "bearer"},
+				"adminToken":   map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+	return json.Marshal(doc)
+}
+
+func (a *app) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(a.openapi)
+}
+
+// funcName returns the name of the function behind a handler or middleware,
+// e.g. "main.(*app).handleGetJob-fm".
+func funcName(fn any) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return ""
+	}
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
+}
+
+// operationID derives an operation ID from the handler name, so
+// handleGetJob becomes getJob.
+func operationID(h http.Handler) string {
+	name := funcName(h)
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "-fm")
+	name = strings.TrimPrefix(name, "handle")
+	if name == "" {
+		return ""
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func hasMiddleware(mws []func(http.Handler) http.Handler, method string) bool {
+	for _, mw := range mws {
+		if strings.HasSuffix(funcName(mw), "."+method+"-fm") {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *schemaGen) responses(res map[int]any) map[string]any {
+	out := map[string]any{
+		"default": map[string]any{
+			"description": "Error",
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": g.ref(reflect.TypeOf(models.ErrorResponse{}))},
+			},
+		},
+	}
+	for status, v := range res {
+		r := map[string]any{"description": http.StatusText(status)}
+		switch v.(type) {
+		case nil:
+		case fileBody:
+			r["content"] = map[string]any{
+				"application/octet-stream": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+			}
+		default:
+			r["content"] = map[string]any{
+				"application/json": map[string]any{"schema": g.ref(reflect.TypeOf(v))},
+			}
+		}
+		out[fmt.Sprint(status)] = r
+	}
+	return out
+}
+
+func (g *schemaGen) requestBody(body any) map[string]any {
+	var content map[string]any
+	switch b := body.(type) {
+	case nil:
+		return nil
+	case formBody:
+		content = map[string]any{"multipart/form-data": map[string]any{"schema": uploadForm(b)}}
+	case rawBody:
+		content = map[string]any{string(b): map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}
+	default:
+		content = map[string]any{"application/json": map[string]any{"schema": g.ref(reflect.TypeOf(b))}}
+	}
+	return map[string]any{"required": true, "content": content}
+}
+
+// uploadForm describes a multipart upload form. Operation parameters are
+// merged across operations; see GET /api/formats for which apply where.
+func uploadForm(form formBody) map[string]any {
+	binary := map[string]any{"type": "string", "format": "binary"}
+	props := map[string]any{"file": binary}
+	required := []string{"file"}
+
+	switch form {
+	case jobForm:
+		props["source_url"] = map[string]any{"type": "string", "format": "uri",
+			"description": "Fetch the input from this URL instead of uploading it."}
+		props["callback_url"] = map[string]any{"type": "string", "format": "uri",
+			"description": "POST a webhook here when the job finishes. Requires an API key."}
+		props["steps"] = map[string]any{"type": "string",
+			"description": `JSON array of {"operation", "preset", "params"} run in order, each on the previous step's output. Replaces operation, preset and parameter fields.`}
+		required = nil
+	case batchForm:
+		props["file"] = map[string]any{"type": "array", "items": binary}
+		props["manifest"] = map[string]any{"type": "string",
+			"description": `JSON array of {"file", "operation", "params"} overriding the shared fields per file.`}
+	}
+	if form == probeForm {
+		return map[string]any{"type": "object", "properties": props, "required": required}
+	}
+	props["preset"] = map[string]any{"type": "string",
+		"description": "Name of a preset supplying the operation and parameters; explicit fields override it."}
+
+	props["retention_hours"] = map[string]any{"type": "integer", "minimum": 1,
+		"description": "Keep the job this many hours instead of the server default, up to the server's maximum."}
+	props["delete_after_download"] = map[string]any{"type": "boolean", "default": false,
+		"description": "Shred the output once it has been downloaded in full."}
+
+	props["operation"] = map[string]any{"type": "string", "enum": operation.Names()}
+	props["output_format"] = map[string]any{"type": "string",
+		"description": "Output format; the default depends on the operation and input."}
+
+	applies := map[string][]string{}
+	for _, s := range operation.All() {
+		for _, p := range s.Schema() {
+			applies[p.Name] = append(applies[p.Name], s.Name)
+			prop := paramSchema(p)
+			if prev, ok := props[p.Name].(map[string]any); ok {
+				// Keep only what every operation agrees on.
+				for k, v := range prev {
+					if fmt.Sprint(prop[k]) != fmt.Sprint(v) {
+						delete(prev, k)
+					}
+				}
+				continue
+			}
+			props[p.Name] = prop
+		}
+	}
+	for name, ops := range applies {
+		props[name].(map[string]any)["description"] = "Applies to " + strings.Join(ops, ", ") + "."
+	}
+
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func paramSchema(p operation.Param) map[string]any {
+	switch p.Type {
+	case operation.ParamBool:
+		return map[string]any{"type": "boolean", "default": p.Default}
+	case operation.ParamSelect:
+		return map[string]any{"type": "integer", "enum": p.Options, "default": p.Default}
+	default:
+		return map[string]any{"type": "integer", "minimum": p.Min, "maximum": p.Max, "default": p.Default}
+	}
+}
+
+// schemaGen turns Go types into JSON schemas the way encoding/json encodes
+// them. Named structs become components referenced by $ref.
+type schemaGen struct {
+	components map[string]any
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (g *schemaGen) ref(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.ref(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := componentName(t)
+		if _, ok := g.components[name]; !ok {
+			g.components[name] = nil // reserve the name for recursive types
+			g.components[name] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+var mainPkg = reflect.TypeOf(routeDoc{}).PkgPath()
+
+// componentName prefixes types outside models with their package, so
+// probe.Result becomes ProbeResult.
+func componentName(t reflect.Type) string {
+	if t.PkgPath() == mainPkg {
+		return strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	}
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	if pkg == "models" {
+		return t.Name()
+	}
+	prefix := strings.ToUpper(pkg[:1]) + pkg[1:]
+	if strings.HasPrefix(t.Name(), prefix) {
+		return t.Name()
+	}
+	return prefix + t.Name()
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	g.fields(t, props, &required)
+
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *schemaGen) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, props, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := g.ref(f.Type)
+		omitempty := strings.Contains(opts, "omitempty")
+		if f.Type.Kind() == reflect.Pointer && !omitempty {
+			if _, isRef := schema["$ref"]; isRef {
+				schema = map[string]any{"allOf": []any{schema}, "nullable": true}
+			} else {
+				schema["nullable"] = true
+			}
+		}
+		props[name] = schema
+		if !omitempty {
+			*required = append(*required, name)
+		}
+	}
+}
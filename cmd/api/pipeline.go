@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"fileforge/internal/errcode"
+	"fileforge/internal/models"
+	"fileforge/internal/operation"
+)
+
+const maxPipelineSteps = 8
+
+// pipelineStepSpec is one entry of the steps field of a job form. A step
+// names an operation, a preset, or both, like the form itself.
+type pipelineStepSpec struct {
+	Operation string                 `json:"operation"`
+	Preset    string                 `json:"preset"`
+	Params    map[string]interface{} `json:"params"`
+}
+
+// validatePipeline parses the steps field of a job form and resolves every
+// step for the format the previous one produces, starting from the
+// uploaded file. It returns the steps and the parameters of the last one,
+// which decide the job's output.
+func (a *app) validatePipeline(r *http.Request, raw, filename, detected string, size int64) ([]models.PipelineStep, models.JobParams, error) {
+	var params models.JobParams
+
+	var specs []pipelineStepSpec
+	if err := json.Unmarshal([]byte(raw), &specs); err != nil {
+		return nil, params, &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter,
+			Msg: `steps must be a JSON array of {"operation", "params"}`}
+	}
+	if len(specs) == 0 || len(specs) > maxPipelineSteps {
+		return nil, params, &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter,
+			Msg: fmt.Sprintf("steps must list between 1 and %d operations", maxPipelineSteps)}
+	}
+
+	steps := make([]models.PipelineStep, 0, len(specs))
+	for i, s := range specs {
+		op := strings.TrimSpace(s.Operation)
+		fields := make(map[string]string, len(s.Params))
+		for k, v := range s.Params {
+			if v != nil {
+				fields[k] = strings.TrimSpace(fmt.Sprint(v))
+			}
+		}
+
+		var err error
+		if name := strings.TrimSpace(s.Preset); name != "" {
+			op, fields, err = a.applyPreset(r, name, op, fields)
+			if err != nil {
+				return nil, params, stepError(i, err)
+			}
+		}
+
+		if i == 0 {
+			params, err = a.validateUpload(op, filename, detected, size, fields)
+		} else {
+			params, err = resolveStep(op, params.OutputFormat, fields)
+		}
+		if err != nil {
+			return nil, params, stepError(i, err)
+		}
+
+		steps = append(steps, models.PipelineStep{
+			Operation: op,
+			Params:    params,
+			Status:    models.StatusPending,
+		})
+	}
+	return steps, params, nil
+}
+
+// resolveStep validates a step after the first, whose input is the output
+// of the previous step in format input.
+func resolveStep(op, input string, fields map[string]string) (models.JobParams, error) {
+	spec := operation.Get(op)
+	if spec == nil {
+		return models.JobParams{}, invalidOperation(op)
+	}
+	if !spec.ValidInput(input) {
+		return models.JobParams{}, &apiError{Status: http.StatusBadRequest, Code: errcode.UnsupportedFormat,
+			Msg: fmt.Sprintf("%s cannot take the .%s output of the previous step", spec.Name, input)}
+	}
+
+	if out, ok := fields["output_format"]; ok {
+		fields = maps.Clone(fields)
+		fields["output_format"] = normalizeExt(out)
+	}
+
+	params, err := spec.Resolve(fields, input)
+	if err != nil {
+		return params, &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter, Msg: err.Error()}
+	}
+	return params, nil
+}
+
+// stepError prefixes the message of a step's validation error with the
+// step's position.
+func stepError(i int, err error) error {
+	var ae *apiError
+	if !errors.As(err, &ae) {
+		return err
+	}
+	prefixed := *ae
+	prefixed.Msg = fmt.Sprintf("step %d: %s", i+1, ae.Msg)
+	return &prefixed
+}
+
+// noSteps rejects the steps field on endpoints that run a single operation,
+// where it would otherwise be silently ignored.
+func noSteps(values url.Values) error {
+	if _, ok := values["steps"]; !ok {
+		return nil
+	}
+	return &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter,
+		Msg: "steps is only supported by POST /api/jobs"}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"fileforge/internal/database"
+	"fileforge/internal/errcode"
+	"fileforge/internal/models"
+	"fileforge/internal/operation"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const maxPresetDescription = 200
+
+var presetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// applyPreset expands the preset called name for a request that named op
+// (possibly empty) and carries the parameter fields fields. The preset's
+// fields are the base and the request's own fields override them; the
+// result is validated with the rest of the upload.
+func (a *app) applyPreset(r *http.Request, name, op string, fields map[string]string) (string, map[string]string, error) {
+	var apiKeyID string
+	if key := apiKeyFromCtx(r); key != nil {
+		apiKeyID = key.ID
+	}
+
+	preset, err := a.db.GetPreset(r.Context(), apiKeyID, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter,
+			Msg: fmt.Sprintf("Unknown preset: %q", name)}
+	}
+	if err != nil {
+		log.Printf("[preset] %v", err)
+		return "", nil, &apiError{Status: http.StatusInternalServerError, Msg: "Database error", Err: err}
+	}
+
+	if op != "" && op != preset.Operation {
+		return "", nil, &apiError{Status: http.StatusBadRequest, Code: errcode.InvalidParameter,
+			Msg: fmt.Sprintf("Preset %q is for %s, not %s", name, preset.Operation, op)}
+	}
+
+	merged := maps.Clone(preset.Params)
+	if merged == nil {
+		merged = make(map[string]string, len(fields))
+	}
+	maps.Copy(merged, fields)
+	return preset.Operation, merged, nil
+}
+
+func (a *app) handleListPresets(w http.ResponseWriter, r *http.Request) {
+	var apiKeyID string
+	if key := apiKeyFromCtx(r); key != nil {
+		apiKeyID = key.ID
+	}
+
+	presets, err := a.db.ListPresets(r.Context(), apiKeyID)
+	if err != nil {
+		log.Printf("[preset] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	out := make([]models.PresetResponse, 0, len(presets))
+	for _, p := range presets {
+		out = append(out, p.ToResponse())
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"presets": out})
+}
+
+// handleCreatePreset stores a preset for the caller's API key. Its fields
+// must resolve on their own, so a job that names only the preset is valid.
+func (a *app) handleCreatePreset(w http.ResponseWriter, r *http.Request) {
+	key := apiKeyFromCtx(r)
+	if key == nil {
+		writeError(w, http.StatusUnauthorized, "Custom presets require an API key")
+		return
+	}
+
+	var req models.CreatePresetRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 16<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if !presetNamePattern.MatchString(req.Name) {
+		writeErrorCode(w, http.StatusBadRequest, errcode.InvalidParameter,
+			"name must be 1-64 lowercase letters, digits, '-' or '_', starting with a letter or digit")
+		return
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if len(req.Description) > maxPresetDescription {
+		writeErrorCode(w, http.StatusBadRequest, errcode.InvalidParameter,
+			fmt.Sprintf("description must be at most %d characters", maxPresetDescription))
+		return
+	}
+
+	spec := operation.Get(strings.TrimSpace(req.Operation))
+	if spec == nil {
+		writeAPIError(w, invalidOperation(req.Operation))
+		return
+	}
+
+	fields := make(map[string]string, len(req.Params))
+	for k, v := range req.Params {
+		fields[k] = strings.TrimSpace(v)
+	}
+	if out, ok := fields["output_format"]; ok {
+		fields["output_format"] = normalizeExt(out)
+	}
+	if _, err := spec.Resolve(fields, spec.Input[0]); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, errcode.InvalidParameter, err.Error())
+		return
+	}
+
+	preset, err := a.db.CreatePreset(r.Context(), key.ID, req.Name, spec.Name, fields, req.Description)
+	if errors.Is(err, database.ErrPresetExists) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("A preset named %q already exists", req.Name))
+		return
+	}
+	if err != nil {
+		log.Printf("[preset] %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to create preset")
+		return
+	}
+
+	log.Printf("[preset] Preset %q created for API key %s", preset.Name, key.ID)
+	writeJSON(w, http.StatusCreated, preset.ToResponse())
+}
+
+func (a *app) handleDeletePreset(w http.ResponseWriter, r *http.Request) {
+	key := apiKeyFromCtx(r)
+	if key == nil {
+		writeError(w, http.StatusUnauthorized, "Custom presets require an API key")
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	deleted, err := a.db.DeletePreset(r.Context(), key.ID, name)
+	if err != nil {
+		log.Printf("[preset] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !deleted {
+		writeError(w, http.StatusNotFound, "Preset not found")
+		return
+	}
+
+	log.Printf("[preset] Preset %q deleted for API key %s", name, key.ID)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "deleted",
+		"id":     name,
+	})
+}
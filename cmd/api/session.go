@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"fileforge/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// handleGetSession returns everything stored about the caller's session:
+// the session itself, usage totals and the full job history.
+func (a *app) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return
+	}
+
+	usage, err := a.db.SessionUsage(ctx, session.ID)
+	if err != nil {
+		log.Printf("[session] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	jobs, err := a.db.ExportSessionJobs(ctx, session.ID)
+	if err != nil {
+		log.Printf("[session] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	resp := models.SessionExport{
+		Session:    session,
+		Usage:      *usage,
+		Jobs:       make([]models.JobResponse, 0, len(jobs)),
+		ExportedAt: time.Now().UTC(),
+	}
+	for _, j := range jobs {
+		resp.Jobs = append(resp.Jobs, j.ToResponse())
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleEraseSession deletes every job, file, batch, upload and share link
+// of the caller's session along with the session row, and stops its queued
+// and running jobs. The response is a signed receipt of what was removed.
+func (a *app) handleEraseSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return
+	}
+
+	erased, err := a.db.EraseSession(ctx, session.ID, a.cfg.RateLimitPerHour)
+	if err != nil {
+		log.Printf("[session] %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to erase session")
+		return
+	}
+
+	// Workers also drop the output of a job whose row is gone, so a failed
+	// cancellation only costs the work already under way.
+	if _, err := a.queue.Cancel(ctx, erased.ActiveJobIDs); err != nil {
+		log.Printf("[session] %v", err)
+	}
+
+	for _, id := range erased.JobIDs {
+		a.store.DeleteJobFiles(id)
+	}
+	for _, id := range erased.UploadIDs {
+		a.store.DeleteUploadFiles(id)
+	}
+
+	receipt := models.ErasureReceipt{
+		ID:            uuid.New().String(),
+		SessionID:     session.ID,
+		ErasedAt:      time.Now().UTC().Truncate(time.Second),
+		Jobs:          len(erased.JobIDs),
+		CancelledJobs: len(erased.ActiveJobIDs),
+		Batches:       erased.Batches,
+		Uploads:       len(erased.UploadIDs),
+		ShareLinks:    erased.ShareLinks,
+		LimitsKept:    erased.LimitsKept,
+	}
+	receipt.Signature = signReceipt(a.receiptKey, receipt)
+
+	log.Printf("[session] Session %s erased: %d jobs (%d cancelled), %d batches, %d uploads, %d share links (receipt %s)",
+		session.ID, receipt.Jobs, receipt.CancelledJobs, receipt.Batches, receipt.Uploads, receipt.ShareLinks, receipt.ID)
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, receipt)
+}
+
+// signReceipt returns the hex HMAC-SHA256 of every receipt field except the
+// signature itself.
+func signReceipt(key []byte, rc models.ErasureReceipt) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s|%s|%s|%d|%d|%d|%d|%d|%t",
+		rc.ID, rc.SessionID, rc.ErasedAt.Format(time.RFC3339),
+		rc.Jobs, rc.CancelledJobs, rc.Batches, rc.Uploads, rc.ShareLinks, rc.LimitsKept)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"fileforge/internal/models"
+	"fileforge/internal/sharelink"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const maxShareDownloads = 1000000
+
+func (a *app) handleCreateShare(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.sessionJob(w, r)
+	if !ok {
+		return
+	}
+
+	if job.Status != models.StatusCompleted || !a.store.OutputExists(job.ID) {
+		writeError(w, http.StatusConflict, "Only completed jobs can be shared")
+		return
+	}
+
+	var req models.CreateShareRequest
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON body")
+			return
+		}
+	}
+
+	ttl := a.cfg.ShareLinkDefaultTTL
+	if req.ExpiresInSeconds != 0 {
+		ttl = time.Duration(req.ExpiresInSeconds) * time.Second
+	}
+	if ttl <= 0 || ttl > a.cfg.ShareLinkMaxTTL {
+		writeError(w, http.StatusBadRequest,
+			fmt.Sprintf("expires_in_seconds must be between 1 and %d", int(a.cfg.ShareLinkMaxTTL.Seconds())))
+		return
+	}
+
+	// Tokens carry whole seconds, and a link never outlives the file.
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	if expiresAt.After(job.ExpiresAt) {
+		expiresAt = job.ExpiresAt.Truncate(time.Second)
+	}
+
+	var maxDownloads sql.NullInt32
+	if req.MaxDownloads != nil {
+		if *req.MaxDownloads < 1 || *req.MaxDownloads > maxShareDownloads {
+			writeError(w, http.StatusBadRequest,
+				fmt.Sprintf("max_downloads must be between 1 and %d", maxShareDownloads))
+			return
+		}
+		maxDownloads = sql.NullInt32{Int32: int32(*req.MaxDownloads), Valid: true}
+	}
+
+	link, err := a.db.CreateShareLink(r.Context(), job.ID, job.SessionID, expiresAt, maxDownloads)
+	if err != nil {
+		log.Printf("[share] %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to create share link")
+		return
+	}
+
+	resp, err := a.shareResponse(link)
+	if err != nil {
+		log.Printf("[share] sign error for %s: %v", link.ID, err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	log.Printf("[share] Link %s created for job %s (expires %s)",
+		link.ID, job.ID, expiresAt.UTC().Format(time.RFC3339))
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (a *app) handleListShares(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.sessionJob(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := a.db.ListShareLinks(r.Context(), job.ID)
+	if err != nil {
+		log.Printf("[share] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	out := make([]models.ShareLinkResponse, 0, len(links))
+	for _, l := range links {
+		resp, err := a.shareResponse(l)
+		if err != nil {
+			log.Printf("[share] sign error for %s: %v", l.ID, err)
+			writeError(w, http.StatusInternalServerError, "Internal error")
+			return
+		}
+		out = append(out, resp)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"links": out})
+}
+
+func (a *app) handleRevokeShare(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.sessionJob(w, r)
+	if !ok {
+		return
+	}
+
+	linkID := chi.URLParam(r, "linkID")
+	if !isValidUUID(linkID) {
+		writeError(w, http.StatusBadRequest, "Invalid link ID")
+		return
+	}
+
+	revoked, err := a.db.RevokeShareLink(r.Context(), job.ID, linkID)
+	if err != nil {
+		log.Printf("[share] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !revoked {
+		writeError(w, http.StatusNotFound, "Share link not found")
+		return
+	}
+
+	log.Printf("[share] Link %s revoked", linkID)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "revoked",
+		"id":     linkID,
+	})
+}
+
+// handleSharedDownload serves a shared output without a session. The
+// signature and expiry are checked before touching the database; the
+// revocation and download limit are enforced by ClaimShareDownload.
+func (a *app) handleSharedDownload(w http.ResponseWriter, r *http.Request) {
+	linkID, err := sharelink.Verify(a.shareKey, chi.URLParam(r, "token"))
+	if err != nil {
+		if errors.Is(err, sharelink.ErrExpired) {
+			writeError(w, http.StatusGone, "Share link has expired")
+		} else {
+			writeError(w, http.StatusNotFound, "Share link not found")
+		}
+		return
+	}
+
+	link, err := a.db.GetShareLink(r.Context(), linkID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "Share link not found")
+		} else {
+			log.Printf("[share] %v", err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+		}
+		return
+	}
+
+	job, err := a.db.GetJob(r.Context(), link.JobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusGone, "Shared file no longer exists")
+		} else {
+			log.Printf("[share] %v", err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+		}
+		return
+	}
+	if job.Status != models.StatusCompleted || !a.store.OutputExists(job.ID) {
+		writeError(w, http.StatusGone, "Shared file no longer exists")
+		return
+	}
+
+	// HEAD requests are answered while the link is valid without using up
+	// a download.
+	if r.Method != http.MethodGet {
+		if !shareUsable(link, time.Now()) {
+			writeError(w, http.StatusGone, "Share link is no longer valid")
+			return
+		}
+		a.serveOutput(w, r, job)
+		return
+	}
+
+	if _, err := a.db.ClaimShareDownload(r.Context(), link.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusGone, "Share link is no longer valid")
+		} else {
+			log.Printf("[share] %v", err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+		}
+		return
+	}
+
+	// Every GET claims a download before serving, so concurrent requests
+	// cannot pass the limit. The claim is kept when the response carried
+	// the end of the file, as a whole body or as a range reaching it, and
+	// given back for 304s, errors and ranges that stop short, so seeking
+	// and resuming use up one download rather than one per request.
+	if d := a.serveOutput(w, r, job); !d.ReachesEnd {
+		if err := a.db.ReleaseShareDownload(context.WithoutCancel(r.Context()), link.ID); err != nil {
+			log.Printf("[share] %v", err)
+		}
+		return
+	}
+
+	log.Printf("[share] Link %s downloaded (%d/%s)", link.ID, link.DownloadCount+1, limitStr(link.MaxDownloads))
+}
+
+// shareUsable reports whether l may still be downloaded from at now.
+func shareUsable(l *models.ShareLink, now time.Time) bool {
+	if l.RevokedAt.Valid || !now.Before(l.ExpiresAt) {
+		return false
+	}
+	return !l.MaxDownloads.Valid || l.DownloadCount < int(l.MaxDownloads.Int32)
+}
+
+func (a *app) shareResponse(l *models.ShareLink) (models.ShareLinkResponse, error) {
+	token, err := sharelink.Sign(a.shareKey, l.ID, l.ExpiresAt)
+	if err != nil {
+		return models.ShareLinkResponse{}, err
+	}
+	return l.ToResponse(a.publicURL("/api/s/" + token)), nil
+}
+
+// publicURL makes path absolute when PUBLIC_BASE_URL is configured.
+func (a *app) publicURL(path string) string {
+	return strings.TrimRight(a.cfg.PublicBaseURL, "/") + path
+}
+
+func limitStr(n sql.NullInt32) string {
+	if !n.Valid {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d", n.Int32)
+}
+
+// sessionJob loads the job named in the URL and makes sure it belongs to the
+// calling session. Jobs of other sessions are reported as not found.
+func (a *app) sessionJob(w http.ResponseWriter, r *http.Request) (*models.Job, bool) {
+	jobID := chi.URLParam(r, "id")
+	if !isValidUUID(jobID) {
+		writeError(w, http.StatusBadRequest, "Invalid job ID")
+		return nil, false
+	}
+
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return nil, false
+	}
+
+	job, err := a.db.GetJob(r.Context(), jobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "Job not found")
+		} else {
+			log.Printf("[job] db error for %s: %v", jobID, err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+		}
+		return nil, false
+	}
+
+	if job.SessionID != session.ID {
+		writeError(w, http.StatusNotFound, "Job not found")
+		return nil, false
+	}
+	return job, true
+}
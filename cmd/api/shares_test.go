@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fileforge/internal/models"
+)
+
+func TestShareDownloadCounting(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 4096)
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	const etag = `"job-1"`
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		counted  bool
+		complete bool
+	}{
+		{"full get", nil, true, true},
+		{"seek", map[string]string{"Range": "bytes=1024-2047"}, false, false},
+		{"open range from start", map[string]string{"Range": "bytes=0-"}, true, true},
+		{"last chunk", map[string]string{"Range": "bytes=3072-4095"}, true, true},
+		{"suffix range", map[string]string{"Range": "bytes=-10"}, true, true},
+		{"range past the end", map[string]string{"Range": "bytes=2048-9999"}, true, true},
+		{"resumed chunk", map[string]string{"Range": "bytes=2048-", "If-Range": etag}, true, true},
+		{"stale if-range", map[string]string{"Range": "bytes=0-9", "If-Range": `"other"`}, true, true},
+		{"several ranges", map[string]string{"Range": "bytes=0-9,10-"}, true, true},
+		{"unsatisfiable range", map[string]string{"Range": "bytes=5000-"}, false, false},
+		{"revalidation", map[string]string{"If-None-Match": etag}, false, false},
+		{"changed since", map[string]string{"If-None-Match": `"other"`}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/s/token", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			rec.Header().Set("ETag", etag)
+
+			d := serveContent(rec, r, modTime, bytes.NewReader(content), int64(len(content)))
+			if d.ReachesEnd != tt.counted || d.Complete != tt.complete {
+				t.Errorf("got %+v (status %d), want counted %v, complete %v",
+					d, rec.Code, tt.counted, tt.complete)
+			}
+		})
+	}
+}
+
+func TestServeContentHead(t *testing.T) {
+	r := httptest.NewRequest(http.MethodHead, "/api/s/token", nil)
+	d := serveContent(httptest.NewRecorder(), r, time.Now(), bytes.NewReader([]byte("data")), 4)
+	if d.Complete {
+		t.Error("a HEAD request must not complete a download")
+	}
+}
+
+func TestShareUsable(t *testing.T) {
+	now := time.Now()
+	link := func(count int, max int32, limited bool) *models.ShareLink {
+		return &models.ShareLink{
+			DownloadCount: count,
+			MaxDownloads:  sql.NullInt32{Int32: max, Valid: limited},
+			ExpiresAt:     now.Add(time.Hour),
+		}
+	}
+
+	if !shareUsable(link(5, 0, false), now) {
+		t.Error("unlimited link should be usable")
+	}
+	if !shareUsable(link(2, 3, true), now) {
+		t.Error("link below its limit should be usable")
+	}
+	if shareUsable(link(3, 3, true), now) {
+		t.Error("link at its limit should not be usable")
+	}
+
+	expired := link(0, 0, false)
+	expired.ExpiresAt = now
+	if shareUsable(expired, now) {
+		t.Error("expired link should not be usable")
+	}
+
+	revoked := link(0, 0, false)
+	revoked.RevokedAt = sql.NullTime{Time: now, Valid: true}
+	if shareUsable(revoked, now) {
+		t.Error("revoked link should not be usable")
+	}
+}
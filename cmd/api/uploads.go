@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	filecrypto "fileforge/internal/crypto"
+	"fileforge/internal/database"
+	"fileforge/internal/models"
+	"fileforge/internal/operation"
+	"fileforge/internal/sniff"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Resumable uploads follow the tus 1.0.0 core protocol with the creation,
+// expiration and termination extensions. Every chunk is encrypted as it
+// arrives, and the job is created once the last byte has been received.
+
+// uploadMetaFields are Upload-Metadata keys that are not operation
+// parameters. tus clients commonly send filetype alongside filename.
+var uploadMetaFields = map[string]bool{
+	"filename":              true,
+	"filetype":              true,
+	"operation":             true,
+	"retention_hours":       true,
+	"delete_after_download": true,
+}
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+func tusResumable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			writeError(w, http.StatusPreconditionFailed, "Unsupported Tus-Resumable version")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *app) handleUploadOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(a.cfg.MaxFileSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) handleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return
+	}
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		writeError(w, http.StatusBadRequest, "Upload-Defer-Length is not supported")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		writeError(w, http.StatusBadRequest, "Invalid Upload-Length")
+		return
+	}
+
+	meta, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid Upload-Metadata")
+		return
+	}
+	filename := sanitizeFilename(meta["filename"])
+	operation := meta["operation"]
+
+	fields := make(map[string]string, len(meta))
+	for k, v := range meta {
+		if !uploadMetaFields[k] {
+			fields[k] = v
+		}
+	}
+
+	params, err := a.validateUpload(operation, filename, "", length, fields)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	retention, burn, err := a.parseRetention(meta["retention_hours"], meta["delete_after_download"])
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	upload, err := a.db.CreateUpload(r.Context(), &models.Upload{
+		ID:           uuid.New().String(),
+		SessionID:    session.ID,
+		Operation:    operation,
+		OriginalName: filename,
+		Params:       params,
+		Length:       length,
+
+		RetentionHours:      retention,
+		DeleteAfterDownload: burn,
+	}, a.cfg.UploadExpiry)
+	if err != nil {
+		log.Printf("[tus] create upload error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to create upload")
+		return
+	}
+
+	if err := a.startUploadFile(upload.ID); err != nil {
+		log.Printf("[tus] create upload file error for %s: %v", upload.ID, err)
+		a.db.DeleteUpload(r.Context(), upload.ID)
+		a.store.DeleteUploadFiles(upload.ID)
+		writeError(w, http.StatusInternalServerError, "Storage error")
+		return
+	}
+
+	log.Printf("[tus] Upload %s created: %s %s (%s)",
+		upload.ID, operation, filename, formatBytes(length))
+
+	w.Header().Set("Location", "/api/uploads/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *app) startUploadFile(uploadID string) error {
+	key, err := filecrypto.DeriveKey(a.cfg.MasterKey, uploadID)
+	if err != nil {
+		return err
+	}
+	enc, err := filecrypto.ResumeEncrypt(key, a.store.InputPath(uploadID), a.store.UploadTailPath(uploadID), 0)
+	if err != nil {
+		return err
+	}
+	_, err = enc.Suspend()
+	return err
+}
+
+func (a *app) handleUploadHead(w http.ResponseWriter, r *http.Request) {
+	upload, ok := a.sessionUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (a *app) handleUploadPatch(w http.ResponseWriter, r *http.Request) {
+	if ct, _, _ := strings.Cut(r.Header.Get("Content-Type"), ";"); strings.TrimSpace(ct) != tusChunkType {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+tusChunkType)
+		return
+	}
+
+	upload, ok := a.sessionUpload(w, r)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "Invalid Upload-Offset")
+		return
+	}
+
+	lock, ok := a.lockUpload(w, r, upload.ID, "Upload is already receiving data")
+	if !ok {
+		return
+	}
+	defer lock.Release(context.WithoutCancel(r.Context()))
+
+	// The row read above may predate a PATCH that held the lock until now.
+	upload, err = a.db.GetUpload(r.Context(), upload.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "Upload not found")
+		} else {
+			log.Printf("[tus] %v", err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+		}
+		return
+	}
+	if offset != upload.Offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		writeError(w, http.StatusConflict, "Upload-Offset does not match the current offset")
+		return
+	}
+
+	key, err := filecrypto.DeriveKey(a.cfg.MasterKey, upload.ID)
+	if err != nil {
+		log.Printf("[tus] key derivation error: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	enc, err := filecrypto.ResumeEncrypt(key, a.store.InputPath(upload.ID), a.store.UploadTailPath(upload.ID), upload.Offset)
+	if err != nil {
+		log.Printf("[tus] resume error for %s: %v", upload.ID, err)
+		if errors.Is(err, filecrypto.ErrInconsistentUpload) {
+			a.terminateUpload(r.Context(), upload.ID)
+			writeError(w, http.StatusGone, "Upload can no longer be resumed; start a new upload")
+		} else {
+			writeError(w, http.StatusInternalServerError, "Storage error")
+		}
+		return
+	}
+
+	// Whatever arrives is kept even if the client goes away mid-chunk, so
+	// the bookkeeping below must not use the request context.
+	ctx := context.WithoutCancel(r.Context())
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, upload.Length-upload.Offset)
+	if upload.Offset == 0 {
+		// A read error here resurfaces from the copy below.
+		var detected string
+		body, detected, _ = sniff.Reader(body)
+		if err := a.setUploadFormat(ctx, upload, detected); err != nil {
+			writeAPIError(w, err)
+			return
+		}
+	}
+	_, copyErr := io.Copy(enc, body)
+
+	if copyErr == nil && enc.Offset() == upload.Length {
+		a.finishUpload(ctx, w, upload, enc)
+		return
+	}
+
+	newOffset, err := enc.Suspend()
+	if err != nil {
+		log.Printf("[tus] suspend error for %s: %v", upload.ID, err)
+		writeError(w, http.StatusInternalServerError, "Storage error")
+		return
+	}
+	if newOffset != upload.Offset {
+		if err := a.db.UpdateUploadOffset(ctx, upload.ID, newOffset); err != nil {
+			log.Printf("[tus] %v", err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(copyErr, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, "Chunk exceeds Upload-Length")
+	case copyErr != nil:
+		log.Printf("[tus] upload %s interrupted at %d: %v", upload.ID, newOffset, copyErr)
+		writeError(w, http.StatusBadRequest, "Upload interrupted")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// setUploadFormat checks the format sniffed from the first chunk against the
+// upload's operation. Uploads whose content the operation cannot take are
+// terminated before anything is stored.
+func (a *app) setUploadFormat(ctx context.Context, upload *models.Upload, detected string) error {
+	if detected == "" {
+		return nil
+	}
+
+	spec := operation.Get(upload.Operation)
+	if spec == nil {
+		return invalidOperation(upload.Operation)
+	}
+	format, err := inputFormat(spec, upload.OriginalName, detected)
+	if err != nil {
+		a.terminateUpload(ctx, upload.ID)
+		return err
+	}
+
+	// Parameters were resolved from the file name when the upload was
+	// created; operations that keep the input format follow the content.
+	params := upload.Params
+	if len(spec.Output) == 0 {
+		params.OutputFormat = format
+	}
+	if err := a.db.SetUploadFormat(ctx, upload.ID, detected, params); err != nil {
+		log.Printf("[tus] %v", err)
+		return &apiError{Status: http.StatusInternalServerError, Msg: "Database error", Err: err}
+	}
+	upload.DetectedFormat = detected
+	upload.Params = params
+	return nil
+}
+
+func (a *app) finishUpload(ctx context.Context, w http.ResponseWriter, upload *models.Upload, enc *filecrypto.ResumableWriter) {
+	if err := enc.Finish(); err != nil {
+		log.Printf("[tus] finish error for %s: %v", upload.ID, err)
+		writeError(w, http.StatusInternalServerError, "Storage error")
+		return
+	}
+
+	job, err := a.db.CompleteUpload(ctx, upload.ID, database.CreateJobParams{
+		SessionID:      upload.SessionID,
+		Operation:      upload.Operation,
+		OriginalName:   upload.OriginalName,
+		DetectedFormat: upload.DetectedFormat,
+		InputSize:      upload.Length,
+		Params:         upload.Params,
+
+		DeleteAfterDownload: upload.DeleteAfterDownload,
+	}, a.retentionHours(upload.RetentionHours))
+	if err != nil {
+		log.Printf("[tus] %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to create job")
+		return
+	}
+
+	if err := a.queue.Enqueue(ctx, job.ID); err != nil {
+		log.Printf("[tus] enqueue error: %v", err)
+		a.db.DeleteJob(ctx, job.ID)
+		a.store.DeleteJobFiles(job.ID)
+		writeError(w, http.StatusInternalServerError, "Failed to queue job")
+		return
+	}
+
+	log.Printf("[tus] Upload %s complete, job queued: %s %s (%s)",
+		job.ID, job.Operation, job.OriginalName, formatBytes(job.InputSize))
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("X-Job-ID", job.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) handleUploadDelete(w http.ResponseWriter, r *http.Request) {
+	upload, ok := a.sessionUpload(w, r)
+	if !ok {
+		return
+	}
+
+	lock, ok := a.lockUpload(w, r, upload.ID, "Upload is receiving data")
+	if !ok {
+		return
+	}
+	defer lock.Release(context.WithoutCancel(r.Context()))
+
+	a.terminateUpload(r.Context(), upload.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lockUpload takes the lock that serialises requests writing to an upload,
+// answering 423 with busyMsg when another request holds it.
+func (a *app) lockUpload(w http.ResponseWriter, r *http.Request, uploadID, busyMsg string) (*database.UploadLock, bool) {
+	lock, err := a.db.LockUpload(r.Context(), uploadID)
+	if errors.Is(err, database.ErrUploadBusy) {
+		writeError(w, http.StatusLocked, busyMsg)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("[tus] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return nil, false
+	}
+	return lock, true
+}
+
+func (a *app) terminateUpload(ctx context.Context, uploadID string) {
+	if _, err := a.db.DeleteUpload(ctx, uploadID); err != nil {
+		log.Printf("[tus] %v", err)
+	}
+	a.store.DeleteUploadFiles(uploadID)
+	log.Printf("[tus] Upload %s terminated", uploadID)
+}
+
+func (a *app) sessionUpload(w http.ResponseWriter, r *http.Request) (*models.Upload, bool) {
+	uploadID := chi.URLParam(r, "id")
+	if !isValidUUID(uploadID) {
+		writeError(w, http.StatusBadRequest, "Invalid upload ID")
+		return nil, false
+	}
+
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return nil, false
+	}
+
+	upload, err := a.db.GetUpload(r.Context(), uploadID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "Upload not found")
+		} else {
+			log.Printf("[tus] db error for %s: %v", uploadID, err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+		}
+		return nil, false
+	}
+
+	if upload.SessionID != session.ID {
+		writeError(w, http.StatusNotFound, "Upload not found")
+		return nil, false
+	}
+	return upload, true
+}
+
+// parseUploadMetadata decodes the tus Upload-Metadata header: comma-separated
+// "key base64value" pairs, where the value may be omitted.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, err
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"fileforge/internal/database"
+	"fileforge/internal/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (a *app) handleAdminListWebhooks(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r)
+	q := r.URL.Query()
+
+	status := q.Get("status")
+	switch status {
+	case "", models.WebhookPending, models.WebhookDelivered, models.WebhookFailed:
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid status filter")
+		return
+	}
+
+	jobID := q.Get("job_id")
+	if jobID != "" && !isValidUUID(jobID) {
+		writeError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	deliveries, err := a.db.ListWebhookDeliveries(r.Context(), database.WebhookFilter{
+		Status: status,
+		JobID:  jobID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		log.Printf("[admin] %v", err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*models.WebhookDelivery{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"deliveries": deliveries,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+func (a *app) handleAdminReplayWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isValidUUID(id) {
+		writeError(w, http.StatusBadRequest, "Invalid delivery ID")
+		return
+	}
+
+	d, err := a.db.ReplayWebhookDelivery(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "Delivery not found")
+		} else {
+			log.Printf("[admin] %v", err)
+			writeError(w, http.StatusInternalServerError, "Database error")
+		}
+		return
+	}
+
+	log.Printf("[admin] Webhook delivery %s replayed by %s", id, adminActorFromCtx(r))
+	writeJSON(w, http.StatusAccepted, d)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	filecrypto "fileforge/internal/crypto"
+	"fileforge/internal/models"
+)
+
+func (a *app) handleBatchZip(w http.ResponseWriter, r *http.Request) {
+	batch, ok := a.sessionBatch(w, r)
+	if !ok {
+		return
+	}
+
+	jobs, err := a.db.ListCompletedJobs(r.Context(), batch.SessionID, batch.ID)
+	if err != nil {
+		log.Printf("[zip] list batch %s: %v", batch.ID, err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	a.streamZip(r.Context(), w, jobs, fmt.Sprintf("batch-%s.zip", batch.ID[:8]))
+}
+
+func (a *app) handleSessionZip(w http.ResponseWriter, r *http.Request) {
+	session := sessionFromCtx(r)
+	if session == nil {
+		writeError(w, http.StatusInternalServerError, "Session error")
+		return
+	}
+
+	jobs, err := a.db.ListCompletedJobs(r.Context(), session.ID, "")
+	if err != nil {
+		log.Printf("[zip] list session %s: %v", session.ID, err)
+		writeError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	a.streamZip(r.Context(), w, jobs, "outputs.zip")
+}
+
+// streamZip decrypts each output straight into the ZIP writer, so nothing is
+// buffered on disk. Once the first byte is sent, errors can only truncate
+// the archive, which clients detect as a corrupt download. Outputs of
+// delete_after_download jobs are shredded once the whole archive is written.
+func (a *app) streamZip(ctx context.Context, w http.ResponseWriter, jobs []*models.Job, filename string) {
+	available := jobs[:0]
+	for _, j := range jobs {
+		if a.store.OutputExists(j.ID) {
+			available = append(available, j)
+		}
+	}
+
+	if len(available) == 0 {
+		writeError(w, http.StatusNotFound, "No completed outputs to download")
+		return
+	}
+
+	names := zipEntryNames(available)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	zw := zip.NewWriter(w)
+
+	for i, job := range available {
+		if err := a.writeZipEntry(zw, job, names[i]); err != nil {
+			log.Printf("[zip] aborting %s at %s: %v", filename, job.ID, err)
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		log.Printf("[zip] close %s: %v", filename, err)
+		return
+	}
+
+	for _, job := range available {
+		if job.DeleteAfterDownload {
+			a.shredOutput(context.WithoutCancel(ctx), job)
+		}
+	}
+}
+
+func (a *app) writeZipEntry(zw *zip.Writer, job *models.Job, name string) error {
+	key, err := filecrypto.DeriveOutputKey(a.cfg.MasterKey, job.ID, job.FileNonce)
+	if err != nil {
+		return err
+	}
+
+	encFile, err := a.store.OpenOutput(job.ID)
+	if err != nil {
+		return err
+	}
+	defer encFile.Close()
+
+	modified := job.CreatedAt
+	if job.CompletedAt.Valid {
+		modified = job.CompletedAt.Time
+	}
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified.In(time.UTC),
+	})
+	if err != nil {
+		return err
+	}
+
+	return filecrypto.DecryptStream(key, encFile, entry)
+}
+
+// zipEntryNames assigns every job a unique, flat entry name. Collisions
+// (compared case-insensitively) get " (2)", " (3)", ... before the extension
+// in job order, so the same set of jobs always yields the same names.
+func zipEntryNames(jobs []*models.Job) []string {
+	used := make(map[string]bool, len(jobs))
+	names := make([]string, len(jobs))
+
+	for i, j := range jobs {
+		name := "output-" + j.ID[:8]
+		if j.OutputFilename.Valid && j.OutputFilename.String != "" {
+			name = j.OutputFilename.String
+		}
+		name = sanitizeFilename(filepath.Base(name))
+		if name == "." || name == ".." {
+			name = "output-" + j.ID[:8]
+		}
+
+		candidate := name
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for n := 2; used[strings.ToLower(candidate)]; n++ {
+			candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+
+		used[strings.ToLower(candidate)] = true
+		names[i] = candidate
+	}
+	return names
+}
@@ -0,0 +1,449 @@
+// Command ilc converts a directory tree through the FileForge API. Every
+// file the operation accepts is submitted as a job, a bounded number at a
+// time, and each output is downloaded into the same relative path under the
+// output directory. Progress is recorded in a state file, so rerunning the
+// same command after an interruption skips finished files and picks up
+// submitted jobs instead of uploading them again.
+//
+//	ilc -op image_convert -param output_format=webp -out ./webp ./photos
+//
+// ilc exits with status 1 if any file failed or the run was interrupted.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"fileforge/pkg/client"
+)
+
+// paramFlag collects repeated -param key=value flags.
+type paramFlag map[string]string
+
+func (p paramFlag) String() string {
+	pairs := make([]string, 0, len(p))
+	for k, v := range p {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (p paramFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(k) == "" {
+		return fmt.Errorf("want key=value, got %q", s)
+	}
+	p[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+
+	params := paramFlag{}
+	apiURL := flag.String("api", envOr("ILC_API_URL", "http://localhost:8080"), "API base URL (env ILC_API_URL)")
+	apiKey := flag.String("api-key", os.Getenv("ILC_API_KEY"), "API key (env ILC_API_KEY)")
+	op := flag.String("op", "", "operation to run, e.g. image_convert")
+	flag.Var(params, "param", "operation parameter as key=value; repeatable (e.g. output_format=webp, quality=80)")
+	outDir := flag.String("out", "", "directory that receives the outputs")
+	statePath := flag.String("state", "", "state file for resuming (default <out>/.ilc-state.json)")
+	parallel := flag.Int("j", 4, "number of files processed at once")
+	poll := flag.Duration("poll", 2*time.Second, "job status polling interval")
+	retries := flag.Int("retries", 4, "attempts per API request")
+	keep := flag.Bool("keep", false, "keep jobs on the server after downloading their output")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: ilc -op OPERATION -out DIR [flags] SRC_DIR\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || *op == "" || *outDir == "" || *parallel < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	srcDir := flag.Arg(0)
+	if *statePath == "" {
+		*statePath = filepath.Join(*outDir, ".ilc-state.json")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := client.New(*apiURL, client.Options{APIKey: *apiKey, MaxAttempts: *retries})
+
+	formats, err := c.Formats(ctx)
+	if err != nil {
+		log.Fatalf("ilc: cannot reach %s: %v", *apiURL, err)
+	}
+	format, ok := formats[*op]
+	if !ok {
+		names := make([]string, 0, len(formats))
+		for name := range formats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Printf("ilc: unknown operation %q; the server supports %s", *op, strings.Join(names, ", "))
+		os.Exit(2)
+	}
+
+	files, err := collectFiles(srcDir, *outDir, format)
+	if err != nil {
+		log.Fatalf("ilc: %v", err)
+	}
+	if len(files) == 0 {
+		log.Printf("ilc: no files in %s can be processed by %s", srcDir, *op)
+		return
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatalf("ilc: %v", err)
+	}
+	state, err := loadState(*statePath)
+	if err != nil {
+		log.Fatalf("ilc: %v", err)
+	}
+	if err := state.claim(*op, params); err != nil {
+		log.Fatalf("ilc: %v", err)
+	}
+
+	r := &runner{
+		client:  c,
+		state:   state,
+		srcDir:  srcDir,
+		outDir:  *outDir,
+		op:      *op,
+		params:  params,
+		poll:    *poll,
+		keep:    *keep,
+		total:   len(files),
+		keepExt: sharedStems(files),
+		outputs: map[string]string{},
+	}
+	r.run(ctx, files, *parallel)
+
+	log.Printf("ilc: %d done, %d skipped, %d failed of %d files",
+		r.done.Load(), r.skipped.Load(), r.failed.Load(), r.total)
+	switch {
+	case ctx.Err() != nil:
+		log.Printf("ilc: interrupted; run the same command again to resume")
+		os.Exit(1)
+	case r.failed.Load() > 0:
+		os.Exit(1)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// collectFiles lists the files under srcDir the operation accepts, relative
+// to srcDir. Hidden entries and the output directory are skipped.
+func collectFiles(srcDir, outDir string, format client.Format) ([]string, error) {
+	absOut, err := filepath.Abs(outDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != srcDir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && abs == absOut {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !format.Accepts(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", srcDir, err)
+	}
+	return files, nil
+}
+
+type runner struct {
+	client *client.Client
+	state  *runState
+	srcDir string
+	outDir string
+	op     string
+	params map[string]string
+	poll   time.Duration
+	keep   bool
+	total  int
+
+	// keepExt holds the files whose outputs keep the source extension;
+	// outputs maps each output path claimed in this run to its input.
+	keepExt map[string]bool
+	mu      sync.Mutex
+	outputs map[string]string
+
+	done, skipped, failed atomic.Int64
+}
+
+func (r *runner) run(ctx context.Context, files []string, parallel int) {
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range work {
+				r.process(ctx, rel)
+			}
+		}()
+	}
+
+feed:
+	for _, rel := range files {
+		select {
+		case work <- rel:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+func (r *runner) finished() int64 {
+	return r.done.Load() + r.skipped.Load() + r.failed.Load()
+}
+
+func (r *runner) process(ctx context.Context, rel string) {
+	info, err := os.Stat(filepath.Join(r.srcDir, rel))
+	if err != nil {
+		r.fail(rel, fileState{}, err)
+		return
+	}
+	st := fileState{Size: info.Size(), ModTime: info.ModTime()}
+
+	prev, ok := r.state.get(rel)
+	sameInput := ok && prev.Size == st.Size && prev.ModTime.Equal(st.ModTime)
+	if sameInput && prev.Status == fileDone {
+		if _, err := os.Stat(filepath.Join(r.outDir, prev.Output)); err == nil {
+			r.claimOutput(rel, prev.Output)
+			r.skipped.Add(1)
+			return
+		}
+	}
+
+	var job *client.Job
+	if sameInput && prev.Status == fileSubmitted && prev.JobID != "" {
+		log.Printf("[%d/%d] %s: resuming job %s", r.finished(), r.total, rel, prev.JobID)
+		job, err = r.wait(ctx, rel, prev.JobID)
+		if client.IsNotFound(err) {
+			// The job expired on the server; submit the file again.
+			job, err = nil, nil
+		}
+	}
+	if job == nil && err == nil {
+		job, err = r.submit(ctx, rel, st)
+		if err == nil {
+			job, err = r.wait(ctx, rel, job.ID)
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		if job != nil {
+			st.JobID = job.ID
+		}
+		r.fail(rel, st, err)
+		return
+	}
+
+	st.JobID = job.ID
+	st.Output = outputPath(rel, job.OutputFilename, r.keepExt[rel])
+	if other, ok := r.claimOutput(rel, st.Output); !ok {
+		r.fail(rel, st, fmt.Errorf("output %s is already the output of %s", st.Output, other))
+		return
+	}
+	if err := r.download(ctx, job.ID, st.Output); err != nil {
+		if ctx.Err() == nil {
+			r.fail(rel, st, err)
+		}
+		return
+	}
+
+	if !r.keep {
+		if err := r.client.Delete(ctx, job.ID); err != nil {
+			log.Printf("%s: delete job %s: %v", rel, job.ID, err)
+		}
+	}
+
+	st.Status = fileDone
+	if err := r.state.set(rel, st); err != nil {
+		log.Printf("ilc: %v", err)
+	}
+	r.done.Add(1)
+	log.Printf("[%d/%d] %s -> %s", r.finished(), r.total, rel, st.Output)
+}
+
+func (r *runner) submit(ctx context.Context, rel string, st fileState) (*client.Job, error) {
+	log.Printf("[%d/%d] %s: uploading %s", r.finished(), r.total, rel, formatSize(st.Size))
+
+	params := make(map[string]string, len(r.params))
+	for k, v := range r.params {
+		params[k] = v
+	}
+	outputFormat := params["output_format"]
+	delete(params, "output_format")
+
+	job, err := r.client.UploadFile(ctx, filepath.Join(r.srcDir, rel), client.JobRequest{
+		Operation:    r.op,
+		Params:       params,
+		OutputFormat: outputFormat,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	st.Status = fileSubmitted
+	st.JobID = job.ID
+	if err := r.state.set(rel, st); err != nil {
+		log.Printf("ilc: %v", err)
+	}
+	return job, nil
+}
+
+func (r *runner) wait(ctx context.Context, rel, jobID string) (*client.Job, error) {
+	return r.client.Wait(ctx, jobID, r.poll, func(j *client.Job) {
+		if j.Status == client.StatusProcessing {
+			log.Printf("[%d/%d] %s: processing", r.finished(), r.total, rel)
+		}
+	})
+}
+
+// download writes the output through a temporary file next to its final
+// path, so a partial download is never mistaken for a finished one.
+func (r *runner) download(ctx context.Context, jobID, output string) error {
+	dst := filepath.Join(r.outDir, output)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".ilc-download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := r.client.Download(ctx, jobID, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (r *runner) fail(rel string, st fileState, err error) {
+	if errors.Is(err, client.ErrJobFailed) {
+		st.Error = strings.TrimPrefix(err.Error(), client.ErrJobFailed.Error()+": ")
+	} else {
+		st.Error = err.Error()
+	}
+	st.Status = fileFailed
+	if err := r.state.set(rel, st); err != nil {
+		log.Printf("ilc: %v", err)
+	}
+	r.failed.Add(1)
+	log.Printf("[%d/%d] %s: FAILED: %s", r.finished(), r.total, rel, st.Error)
+}
+
+// outputPath mirrors rel under the output directory, taking the extension
+// of the server's output file name. With keepExt the source extension stays
+// in the name (a.jpg.webp).
+func outputPath(rel, outputFilename string, keepExt bool) string {
+	ext := filepath.Ext(outputFilename)
+	if ext == "" {
+		return rel
+	}
+	if keepExt {
+		return rel + ext
+	}
+	return strings.TrimSuffix(rel, filepath.Ext(rel)) + ext
+}
+
+// sharedStems returns the files whose path without extension is shared with
+// another file, ignoring case, like a.jpg and a.png. Converted to the same
+// format they would land on one output, so theirs keep the source extension.
+func sharedStems(files []string) map[string]bool {
+	byStem := make(map[string][]string, len(files))
+	for _, rel := range files {
+		stem := strings.ToLower(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		byStem[stem] = append(byStem[stem], rel)
+	}
+
+	shared := make(map[string]bool)
+	for _, group := range byStem {
+		if len(group) > 1 {
+			for _, rel := range group {
+				shared[rel] = true
+			}
+		}
+	}
+	return shared
+}
+
+// claimOutput reserves output for rel, so no two inputs of a run write the
+// same file. It returns the input already holding output, if any.
+func (r *runner) claimOutput(rel, output string) (string, bool) {
+	key := strings.ToLower(output)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if other, ok := r.outputs[key]; ok && other != rel {
+		return other, false
+	}
+	r.outputs[key] = rel
+	return "", true
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	fileSubmitted = "submitted"
+	fileDone      = "done"
+	fileFailed    = "failed"
+)
+
+// fileState records how far one input got. Size and ModTime identify the
+// version of the file that was processed, so edited inputs are redone.
+type fileState struct {
+	Status  string    `json:"status"`
+	JobID   string    `json:"job_id,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Output  string    `json:"output,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// runState is the resumable progress of a run, keyed by input path relative
+// to the source directory. It is rewritten after every change. Operation and
+// Params record what the files were processed with, so a run with other
+// settings cannot take their outputs as done.
+type runState struct {
+	path string
+
+	mu        sync.Mutex
+	Operation string                `json:"operation"`
+	Params    map[string]string     `json:"params,omitempty"`
+	Files     map[string]*fileState `json:"files"`
+}
+
+func loadState(path string) (*runState, error) {
+	s := &runState{path: path, Files: map[string]*fileState{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parse state %s: %w", path, err)
+	}
+	if s.Files == nil {
+		s.Files = map[string]*fileState{}
+	}
+	return s, nil
+}
+
+// claim binds the state to op and params. A state that already records
+// files of a run with other settings is refused rather than reused.
+func (s *runState) claim(op string, params map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.Files) > 0 && (s.Operation != op || !maps.Equal(s.Params, params)) {
+		return fmt.Errorf("%s belongs to a run with -op %q -param %q; use another -out or -state, or delete it to start over",
+			s.path, s.Operation, paramFlag(s.Params).String())
+	}
+	s.Operation = op
+	s.Params = params
+	return nil
+}
+
+func (s *runState) get(rel string) (fileState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fs, ok := s.Files[rel]
+	if !ok {
+		return fileState{}, false
+	}
+	return *fs, true
+}
+
+func (s *runState) set(rel string, fs fileState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Files[rel] = &fs
+	return s.save()
+}
+
+// save writes the state through a temporary file so an interrupted run
+// never leaves it truncated. The caller holds mu.
+func (s *runState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".ilc-state-*")
+	if err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write state: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
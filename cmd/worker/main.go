@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -14,17 +16,26 @@ import (
 	"fileforge/internal/config"
 	filecrypto "fileforge/internal/crypto"
 	"fileforge/internal/database"
+	"fileforge/internal/errcode"
+	"fileforge/internal/fetch"
 	"fileforge/internal/models"
+	"fileforge/internal/operation"
 	"fileforge/internal/processor"
 	"fileforge/internal/queue"
 	"fileforge/internal/storage"
+	"fileforge/internal/webhook"
 )
 
 type worker struct {
-	cfg   *config.Config
-	db    *database.DB
-	queue *queue.Queue
-	store *storage.Storage
+	cfg      *config.Config
+	db       *database.DB
+	queue    *queue.Queue
+	store    *storage.Storage
+	notifier *webhook.Notifier
+
+	// running maps the IDs of jobs being processed to the functions that
+	// abandon them.
+	running sync.Map
 }
 
 func main() {
@@ -36,6 +47,12 @@ func main() {
 		log.Fatalf("Config error: %v", err)
 	}
 
+	for _, spec := range operation.All() {
+		if processor.Funcs[spec.Name] == nil {
+			log.Fatalf("No processor registered for operation %s", spec.Name)
+		}
+	}
+
 	db, err := database.New(cfg.DSN())
 	if err != nil {
 		log.Fatalf("Database error: %v", err)
@@ -57,7 +74,30 @@ func main() {
 		log.Fatalf("tmpfs directory error: %v", err)
 	}
 
-	w := &worker{cfg: cfg, db: db, queue: q, store: store}
+	shareKey, err := filecrypto.DeriveSubkey(cfg.MasterKey, "share-link")
+	if err != nil {
+		log.Fatalf("Key derivation error: %v", err)
+	}
+
+	w := &worker{
+		cfg:   cfg,
+		db:    db,
+		queue: q,
+		store: store,
+		notifier: &webhook.Notifier{
+			DB:            db,
+			ShareKey:      shareKey,
+			PublicBaseURL: cfg.PublicBaseURL,
+		},
+	}
+
+	dispatcher := &webhook.Dispatcher{
+		DB:          db,
+		Client:      fetch.New(fetch.Options{Timeout: cfg.WebhookTimeout}).Client(),
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		Timeout:     cfg.WebhookTimeout,
+		Interval:    2 * time.Second,
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -74,6 +114,14 @@ func main() {
 		}(i)
 	}
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		dispatcher.Run(ctx)
+	}()
+
+	go w.watchCancellations(ctx)
+
 	log.Printf("Worker ready — %d goroutines listening on queue", cfg.WorkerConcurrency)
 
 	<-done
@@ -125,6 +173,17 @@ func (w *worker) run(ctx context.Context, id int) {
 	}
 }
 
+// watchCancellations abandons jobs that are cancelled while this worker is
+// processing them.
+func (w *worker) watchCancellations(ctx context.Context) {
+	for jobID := range w.queue.Cancellations(ctx) {
+		if cancel, ok := w.running.Load(jobID); ok {
+			log.Printf("[worker] Cancelling job %s", jobID)
+			cancel.(context.CancelFunc)()
+		}
+	}
+}
+
 func (w *worker) processJob(ctx context.Context, workerID int, jobID string) {
 	startTime := time.Now()
 	log.Printf("[worker-%d] ▶ Job %s", workerID, jobID)
@@ -132,7 +191,7 @@ func (w *worker) processJob(ctx context.Context, workerID int, jobID string) {
 	tmpDir := filepath.Join(w.cfg.TmpDir, jobID)
 	if err := os.MkdirAll(tmpDir, 0700); err != nil {
 		log.Printf("[worker-%d] ✗ tmpdir error: %v", workerID, err)
-		w.failJob(ctx, jobID, "Internal error: failed to create temp directory")
+		w.failJob(ctx, jobID, errcode.Internal)
 		return
 	}
 	defer os.RemoveAll(tmpDir)
@@ -153,21 +212,28 @@ func (w *worker) processJob(ctx context.Context, workerID int, jobID string) {
 		return
 	}
 
+	jobCtx, cancelJob := context.WithCancel(ctx)
+	w.running.Store(jobID, cancelJob)
+	defer func() {
+		w.running.Delete(jobID)
+		cancelJob()
+	}()
+
 	key, err := filecrypto.DeriveKey(w.cfg.MasterKey, jobID)
 	if err != nil {
 		log.Printf("[worker-%d] ✗ key derivation error: %v", workerID, err)
-		w.failJob(ctx, jobID, "Encryption key derivation failed")
+		w.failJob(ctx, jobID, errcode.Internal)
 		return
 	}
 
 	params, err := models.ParseParams(job.Params)
 	if err != nil {
 		log.Printf("[worker-%d] ✗ parse params error: %v", workerID, err)
-		w.failJob(ctx, jobID, fmt.Sprintf("Invalid parameters: %v", err))
+		w.failJob(ctx, jobID, errcode.InvalidParameter)
 		return
 	}
 
-	inputExt := job.InputExt()
+	inputExt := job.InputFormat()
 	if inputExt == "" {
 		inputExt = "bin"
 	}
@@ -177,7 +243,7 @@ func (w *worker) processJob(ctx context.Context, workerID int, jobID string) {
 
 	if err := filecrypto.DecryptFile(key, w.store.InputPath(jobID), tmpInput); err != nil {
 		log.Printf("[worker-%d] ✗ decrypt error: %v", workerID, err)
-		w.failJob(ctx, jobID, fmt.Sprintf("Failed to decrypt input: %v", err))
+		w.failJob(ctx, jobID, errcode.Internal)
 		return
 	}
 
@@ -189,37 +255,61 @@ func (w *worker) processJob(ctx context.Context, workerID int, jobID string) {
 
 	log.Printf("[worker-%d] Processing %s: %s → .%s", workerID, job.Operation, job.OriginalName, outExt)
 
-	timeout := w.cfg.TimeoutFor(job.Operation)
-	processCtx, processCancel := context.WithTimeout(ctx, timeout)
-	processErr := w.dispatch(processCtx, job.Operation, tmpInput, tmpOutput, tmpDir, params)
-	processCancel()
+	if len(job.Steps) > 0 {
+		if !w.runPipeline(ctx, jobCtx, workerID, job, tmpInput, tmpOutput, tmpDir) {
+			return
+		}
+	} else {
+		timedOut, processErr := w.runStep(jobCtx, job.Operation, tmpInput, tmpOutput, tmpDir, params)
+
+		if jobCtx.Err() != nil && ctx.Err() == nil {
+			log.Printf("[worker-%d] ⊘ Job %s cancelled", workerID, jobID)
+			return
+		}
 
-	if processErr != nil {
-		log.Printf("[worker-%d] ✗ process error: %v", workerID, processErr)
-		w.handleProcessError(ctx, workerID, jobID, job.Operation, processErr)
-		return
+		if processErr != nil {
+			log.Printf("[worker-%d] ✗ process error: %v", workerID, processErr)
+			code := failureCode(processErr, timedOut)
+			w.handleProcessError(ctx, workerID, jobID, job.Operation, processErr, code, errcode.Message(code))
+			return
+		}
 	}
 
 	outputInfo, err := os.Stat(tmpOutput)
 	if err != nil || outputInfo.Size() == 0 {
 		log.Printf("[worker-%d] ✗ output missing or empty: err=%v", workerID, err)
-		w.failJob(ctx, jobID, "Processing completed but output file is missing or empty")
+		w.failJob(ctx, jobID, errcode.ProcessingFailed)
 		return
 	}
 	outputSize := outputInfo.Size()
 
 	log.Printf("[worker-%d] Encrypting output (%s) → %s", workerID, formatBytes(outputSize), w.store.OutputPath(jobID))
 
-	if err := filecrypto.EncryptFile(key, tmpOutput, w.store.OutputPath(jobID)); err != nil {
+	outKey, err := filecrypto.DeriveOutputKey(w.cfg.MasterKey, jobID, job.FileNonce)
+	if err != nil {
+		log.Printf("[worker-%d] ✗ key derivation error: %v", workerID, err)
+		w.failJob(ctx, jobID, errcode.Internal)
+		return
+	}
+	if err := filecrypto.EncryptFile(outKey, tmpOutput, w.store.OutputPath(jobID)); err != nil {
 		log.Printf("[worker-%d] ✗ encrypt output error: %v", workerID, err)
-		w.failJob(ctx, jobID, fmt.Sprintf("Failed to encrypt output: %v", err))
+		w.failJob(ctx, jobID, errcode.Internal)
 		return
 	}
 
 	outputFilename := models.OutputName(job.OriginalName, params.OutputFormat)
 
-	if err := w.db.UpdateJobCompleted(ctx, jobID, outputFilename, outputSize); err != nil {
+	err = w.db.UpdateJobCompleted(ctx, jobID, outputFilename, outputSize)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The job was deleted while it was being processed.
+		log.Printf("[worker-%d] ⊘ Job %s no longer exists, discarding output", workerID, jobID)
+		w.store.DeleteOutput(jobID)
+		return
+	}
+	if err != nil {
 		log.Printf("[worker-%d] ✗ update completed error: %v", workerID, err)
+	} else {
+		w.notifyFinished(ctx, jobID)
 	}
 
 	elapsed := time.Since(startTime).Round(time.Millisecond)
@@ -229,32 +319,138 @@ func (w *worker) processJob(ctx context.Context, workerID int, jobID string) {
 		formatBytes(job.InputSize), formatBytes(outputSize))
 }
 
+// runStep runs one operation under its timeout and reports whether the
+// timeout expired.
+func (w *worker) runStep(ctx context.Context, operation, inputPath, outputPath, tmpDir string, params models.JobParams) (bool, error) {
+	processCtx, cancel := context.WithTimeout(ctx, w.cfg.TimeoutFor(operation))
+	defer cancel()
+	err := w.dispatch(processCtx, operation, inputPath, outputPath, tmpDir, params)
+	return errors.Is(processCtx.Err(), context.DeadlineExceeded), err
+}
+
+// runPipeline runs the steps of a pipeline job in order through the job's
+// tmpfs directory: each step reads the previous step's output, and only the
+// last one writes outputPath. Step progress is saved after every
+// transition. It returns false if the job was cancelled, failed or
+// requeued.
+func (w *worker) runPipeline(ctx, jobCtx context.Context, workerID int, job *models.Job, inputPath, outputPath, tmpDir string) bool {
+	steps := job.Steps
+	for i := range steps {
+		// A retried job starts over from the first step.
+		steps[i] = models.PipelineStep{
+			Operation: steps[i].Operation,
+			Params:    steps[i].Params,
+			Status:    models.StatusPending,
+		}
+	}
+
+	input := inputPath
+	for i := range steps {
+		step := &steps[i]
+
+		stepOutput := outputPath
+		if i < len(steps)-1 {
+			stepOutput = filepath.Join(tmpDir, fmt.Sprintf("step%d.%s", i+1, step.Params.OutputFormat))
+		}
+		stepDir := filepath.Join(tmpDir, fmt.Sprintf("step%d", i+1))
+		if err := os.MkdirAll(stepDir, 0700); err != nil {
+			log.Printf("[worker-%d] ✗ tmpdir error: %v", workerID, err)
+			w.failJob(ctx, job.ID, errcode.Internal)
+			return false
+		}
+
+		started := time.Now()
+		step.Status, step.StartedAt = models.StatusProcessing, &started
+		w.saveSteps(ctx, job.ID, steps)
+		log.Printf("[worker-%d] Step %d/%d: %s → .%s", workerID, i+1, len(steps), step.Operation, step.Params.OutputFormat)
+
+		timedOut, err := w.runStep(jobCtx, step.Operation, input, stepOutput, stepDir, step.Params)
+		os.RemoveAll(stepDir)
+		if input != inputPath {
+			// The previous step's output has been consumed.
+			os.Remove(input)
+		}
+
+		if jobCtx.Err() != nil && ctx.Err() == nil {
+			log.Printf("[worker-%d] ⊘ Job %s cancelled", workerID, job.ID)
+			return false
+		}
+
+		if err == nil {
+			info, statErr := os.Stat(stepOutput)
+			if statErr != nil || info.Size() == 0 {
+				err = fmt.Errorf("output missing or empty: %v", statErr)
+			} else {
+				step.OutputSize = info.Size()
+			}
+		}
+
+		finished := time.Now()
+		step.CompletedAt = &finished
+		if err != nil {
+			code := failureCode(err, timedOut)
+			step.Status, step.ErrorCode, step.ErrorMessage = models.StatusFailed, string(code), errcode.Message(code)
+			w.saveSteps(ctx, job.ID, steps)
+
+			log.Printf("[worker-%d] ✗ step %d (%s) error: %v", workerID, i+1, step.Operation, err)
+			msg := fmt.Sprintf("Step %d of %d (%s) failed: %s", i+1, len(steps), step.Operation, step.ErrorMessage)
+			w.handleProcessError(ctx, workerID, job.ID, step.Operation, err, code, msg)
+			return false
+		}
+
+		step.Status = models.StatusCompleted
+		w.saveSteps(ctx, job.ID, steps)
+		input = stepOutput
+	}
+	return true
+}
+
+func (w *worker) saveSteps(ctx context.Context, jobID string, steps []models.PipelineStep) {
+	if err := w.db.UpdateJobSteps(ctx, jobID, steps); err != nil {
+		log.Printf("[worker] %v", err)
+	}
+}
+
 func (w *worker) dispatch(ctx context.Context, operation, inputPath, outputPath, tmpDir string, params models.JobParams) error {
-	switch operation {
-	case models.OpImageConvert:
-		return processor.ImageConvert(ctx, inputPath, outputPath, params)
-	case models.OpImageCompress:
-		return processor.ImageCompress(ctx, inputPath, outputPath, params)
-	case models.OpImageRemoveBG:
-		return processor.ImageRemoveBG(ctx, inputPath, outputPath, w.cfg.RembgURL, params)
-	case models.OpPDFCompress:
-		return processor.PDFCompress(ctx, inputPath, outputPath, tmpDir, params)
-	case models.OpAudioConvert:
-		return processor.AudioConvert(ctx, inputPath, outputPath, params)
-	case models.OpAudioCompress:
-		return processor.AudioCompress(ctx, inputPath, outputPath, params)
-	case models.OpVideoCompress:
-		return processor.VideoCompress(ctx, inputPath, outputPath, params)
-	default:
+	fn, ok := processor.Funcs[operation]
+	if !ok {
 		return fmt.Errorf("unsupported operation: %s", operation)
 	}
+	return processor.Classify(fn(ctx, processor.Task{
+		InputPath:  inputPath,
+		OutputPath: outputPath,
+		TmpDir:     tmpDir,
+		Params:     params,
+		RembgURL:   w.cfg.RembgURL,
+	}))
+}
+
+// failureCode is the error code recorded for a processing error.
+func failureCode(processErr error, timedOut bool) errcode.Code {
+	switch {
+	case timedOut:
+		return errcode.ProcessingTimeout
+	case errors.Is(processErr, processor.ErrCorruptInput):
+		return errcode.CorruptInput
+	default:
+		return errcode.ProcessingFailed
+	}
 }
 
-func (w *worker) handleProcessError(ctx context.Context, workerID int, jobID, operation string, processErr error) {
+// handleProcessError requeues a job whose operation failed, or fails it
+// with code and msg once its retries are used up. operation decides how
+// many retries there are.
+func (w *worker) handleProcessError(ctx context.Context, workerID int, jobID, operation string, processErr error, code errcode.Code, msg string) {
+	if code == errcode.CorruptInput {
+		log.Printf("[worker-%d] ✗ Job %s has a corrupt input, not retrying", workerID, jobID)
+		w.failJobWith(ctx, jobID, code, msg)
+		return
+	}
+
 	retryCount, err := w.db.IncrementRetryCount(ctx, jobID)
 	if err != nil {
 		log.Printf("[worker-%d] Retry count increment failed for %s: %v", workerID, jobID, err)
-		w.failJob(ctx, jobID, processErr.Error())
+		w.failJobWith(ctx, jobID, code, msg)
 		return
 	}
 
@@ -265,21 +461,41 @@ func (w *worker) handleProcessError(ctx context.Context, workerID int, jobID, op
 			workerID, jobID, retryCount, maxRetries, processErr)
 		if err := w.queue.Requeue(ctx, jobID); err != nil {
 			log.Printf("[worker-%d] Requeue failed for %s: %v", workerID, jobID, err)
-			w.failJob(ctx, jobID, processErr.Error())
+			w.failJobWith(ctx, jobID, code, msg)
 		}
 	} else {
 		log.Printf("[worker-%d] ✗ Job %s permanently failed after %d attempts: %v",
 			workerID, jobID, retryCount, processErr)
-		w.failJob(ctx, jobID, processErr.Error())
+		w.failJobWith(ctx, jobID, code, msg)
 	}
 }
 
-func (w *worker) failJob(ctx context.Context, jobID, msg string) {
-	if len(msg) > 1000 {
-		msg = msg[:1000] + "…"
-	}
-	if err := w.db.UpdateJobFailed(ctx, jobID, msg); err != nil {
+func (w *worker) failJob(ctx context.Context, jobID string, code errcode.Code) {
+	w.failJobWith(ctx, jobID, code, errcode.Message(code))
+}
+
+// failJobWith records code and a user-facing message on the job. The error
+// that caused the failure has already been logged and is never stored.
+func (w *worker) failJobWith(ctx context.Context, jobID string, code errcode.Code, msg string) {
+	if err := w.db.UpdateJobFailed(ctx, jobID, string(code), msg); err != nil {
 		log.Printf("[worker] Failed to mark job %s as failed: %v", jobID, err)
+		return
+	}
+	w.notifyFinished(ctx, jobID)
+}
+
+func (w *worker) notifyFinished(ctx context.Context, jobID string) {
+	if err := w.queue.NotifyDone(ctx, jobID); err != nil {
+		log.Printf("[worker] %v", err)
+	}
+
+	job, err := w.db.GetJob(ctx, jobID)
+	if err != nil {
+		log.Printf("[webhook] load job %s: %v", jobID, err)
+		return
+	}
+	if err := w.notifier.JobFinished(ctx, job); err != nil {
+		log.Printf("[webhook] queue delivery for %s: %v", jobID, err)
 	}
 }
 
@@ -11,12 +11,24 @@ CREATE TABLE sessions (
     total_request_count  INTEGER NOT NULL DEFAULT 0,
     is_flagged          BOOLEAN NOT NULL DEFAULT FALSE,
 
+    pow_allowance_until     TIMESTAMPTZ,
+    pow_allowance_remaining INTEGER NOT NULL DEFAULT 0,
+
     CONSTRAINT uq_sessions_ip UNIQUE (ip_address)
 );
 
 CREATE INDEX idx_sessions_ip ON sessions (ip_address);
 CREATE INDEX idx_sessions_flagged ON sessions (is_flagged) WHERE is_flagged = TRUE;
 
+CREATE TABLE pow_redemptions (
+    challenge_id    UUID PRIMARY KEY,
+    ip_address      INET NOT NULL,
+    redeemed_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_pow_redemptions_expires ON pow_redemptions (expires_at);
+
 CREATE TYPE job_status AS ENUM (
     'pending',
     'processing',
@@ -24,20 +36,35 @@ CREATE TYPE job_status AS ENUM (
     'failed'
 );
 
-CREATE TYPE job_operation AS ENUM (
-    'image_convert',
-    'image_compress',
-    'image_remove_bg',
-    'pdf_compress',
-    'audio_convert',
-    'audio_compress',
-    'video_compress'
+CREATE TABLE api_keys (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name            TEXT NOT NULL,
+    key_hash        BYTEA NOT NULL,
+    key_prefix      TEXT NOT NULL,
+    webhook_secret  TEXT NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at    TIMESTAMPTZ,
+    revoked_at      TIMESTAMPTZ,
+
+    CONSTRAINT uq_api_keys_hash UNIQUE (key_hash)
 );
 
+CREATE TABLE batches (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    session_id      UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_batches_session ON batches (session_id);
+CREATE INDEX idx_batches_expires ON batches (expires_at);
+
 CREATE TABLE jobs (
     id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     session_id      UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
-    operation       job_operation NOT NULL,
+    batch_id        UUID REFERENCES batches(id) ON DELETE CASCADE,
+    api_key_id      UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+    operation       TEXT NOT NULL,
     status          job_status NOT NULL DEFAULT 'pending',
 
     input_filename  TEXT NOT NULL,
@@ -45,11 +72,18 @@ CREATE TABLE jobs (
     input_size      BIGINT NOT NULL DEFAULT 0,
     output_size     BIGINT,
     original_name   TEXT NOT NULL,
+    detected_format TEXT,
 
     params          JSONB NOT NULL DEFAULT '{}',
+    steps           JSONB,
+    input_hash      BYTEA,
+    callback_url    TEXT,
 
     file_nonce      BYTEA,
+    delete_after_download BOOLEAN NOT NULL DEFAULT FALSE,
+    downloaded_at   TIMESTAMPTZ,
 
+    error_code      TEXT,
     error_message   TEXT,
     retry_count     INTEGER NOT NULL DEFAULT 0,
 
@@ -62,11 +96,130 @@ CREATE TABLE jobs (
     CONSTRAINT chk_retry_count CHECK (retry_count >= 0)
 );
 
-CREATE INDEX idx_jobs_session ON jobs (session_id);
+CREATE INDEX idx_jobs_session_created ON jobs (session_id, created_at, id);
+CREATE INDEX idx_jobs_batch ON jobs (batch_id) WHERE batch_id IS NOT NULL;
 CREATE INDEX idx_jobs_status ON jobs (status);
 CREATE INDEX idx_jobs_expires ON jobs (expires_at) WHERE status != 'failed';
 CREATE INDEX idx_jobs_created ON jobs (created_at);
 CREATE INDEX idx_jobs_status_created ON jobs (status, created_at);
+CREATE INDEX idx_jobs_cache ON jobs (session_id, input_hash)
+    WHERE input_hash IS NOT NULL AND status = 'completed';
+
+
+CREATE TABLE idempotency_keys (
+    session_id      UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    key             TEXT NOT NULL,
+    job_id          UUID NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (session_id, key)
+);
+
+CREATE INDEX idx_idempotency_job ON idempotency_keys (job_id);
+
+
+CREATE TABLE share_links (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    job_id          UUID NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    session_id      UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+
+    max_downloads   INTEGER,
+    download_count  INTEGER NOT NULL DEFAULT 0,
+
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ NOT NULL,
+    revoked_at      TIMESTAMPTZ,
+
+    CONSTRAINT chk_share_max_downloads CHECK (max_downloads IS NULL OR max_downloads > 0)
+);
+
+CREATE INDEX idx_share_links_job ON share_links (job_id);
+
+CREATE TYPE webhook_status AS ENUM (
+    'pending',
+    'delivered',
+    'failed'
+);
+
+CREATE TABLE webhook_deliveries (
+    id               UUID PRIMARY KEY,
+    job_id           UUID REFERENCES jobs(id) ON DELETE SET NULL,
+    api_key_id       UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    event            TEXT NOT NULL,
+    url              TEXT NOT NULL,
+    payload          JSONB NOT NULL,
+
+    status           webhook_status NOT NULL DEFAULT 'pending',
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_status_code INTEGER,
+    last_error       TEXT,
+
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at     TIMESTAMPTZ
+);
+
+CREATE INDEX idx_webhook_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_webhook_job ON webhook_deliveries (job_id);
+CREATE INDEX idx_webhook_created ON webhook_deliveries (created_at);
+
+CREATE TABLE uploads (
+    id              UUID PRIMARY KEY,
+    session_id      UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    operation       TEXT NOT NULL,
+    original_name   TEXT NOT NULL,
+    detected_format TEXT,
+    params          JSONB NOT NULL DEFAULT '{}',
+    retention_hours INTEGER,
+    delete_after_download BOOLEAN NOT NULL DEFAULT FALSE,
+
+    upload_length   BIGINT NOT NULL,
+    upload_offset   BIGINT NOT NULL DEFAULT 0,
+
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at      TIMESTAMPTZ NOT NULL,
+
+    CONSTRAINT chk_upload_offset CHECK (upload_offset >= 0 AND upload_offset <= upload_length)
+);
+
+CREATE INDEX idx_uploads_session ON uploads (session_id);
+CREATE INDEX idx_uploads_expires ON uploads (expires_at);
+
+CREATE TABLE presets (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    api_key_id      UUID REFERENCES api_keys(id) ON DELETE CASCADE,
+    name            TEXT NOT NULL,
+    operation       TEXT NOT NULL,
+    params          JSONB NOT NULL DEFAULT '{}',
+    description     TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT uq_presets_key_name UNIQUE NULLS NOT DISTINCT (api_key_id, name)
+);
+
+INSERT INTO presets (name, operation, params, description) VALUES
+    ('web-image',      'image_compress', '{"quality": "75"}',                          'Smaller images for web pages, same format'),
+    ('lossless-image', 'image_compress', '{"lossless": "true"}',                       'Lossless recompression, no visible change'),
+    ('pdf-email',      'pdf_compress',   '{"image_dpi": "72", "image_quality": "60"}',  'Small PDFs for email attachments'),
+    ('pdf-print',      'pdf_compress',   '{"image_dpi": "300", "image_quality": "90"}', 'PDFs that keep print-quality images'),
+    ('podcast',        'audio_compress', '{"quality": "40"}',                          'Spoken-word audio at a low bitrate'),
+    ('web-video',      'video_compress', '{"output_format": "mp4", "quality": "55"}',  'MP4 video for web players'),
+    ('webm-video',     'video_compress', '{"output_format": "webm", "quality": "55"}', 'WebM video for web players');
+
+
+CREATE TABLE admin_audit_log (
+    id              BIGSERIAL PRIMARY KEY,
+    actor           TEXT NOT NULL,
+    method          TEXT NOT NULL,
+    path            TEXT NOT NULL,
+    status          INTEGER NOT NULL,
+    remote_ip       TEXT,
+    request_id      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_admin_audit_created ON admin_audit_log (created_at);
 
 
 CREATE OR REPLACE FUNCTION reset_hourly_counts()
@@ -165,7 +165,7 @@
             clearFile();
         });
 
-        dom.btnProcess.addEventListener('click', startProcessing);
+        dom.btnProcess.addEventListener('click', () => startProcessing());
 
         dom.btnRetry.addEventListener('click', () => {
             resetUI();
@@ -435,7 +435,7 @@
         dom.btnText.textContent = 'Select a file to start';
     }
 
-    function startProcessing() {
+    function startProcessing(retriedChallenge = false) {
         if (!state.selectedFile || state.uploading) return;
 
         state.uploading = true;
@@ -486,12 +486,26 @@
                     showError('Invalid response from server.');
                 }
             } else {
+                let err = null;
                 try {
-                    const err = JSON.parse(xhr.responseText);
-                    showError(err.error || `Upload failed (HTTP ${xhr.status})`);
+                    err = JSON.parse(xhr.responseText);
                 } catch (e) {
-                    showError(`Upload failed (HTTP ${xhr.status})`);
                 }
+
+                if (err && err.challenge && !retriedChallenge) {
+                    dom.progressLabel.textContent = 'Verifying your connection...';
+                    dom.progressDetail.textContent = 'Too many requests from your network. Solving a short challenge to continue.';
+                    solveChallenge(err.challenge).then((ok) => {
+                        if (ok) {
+                            startProcessing(true);
+                        } else {
+                            showError(err.error);
+                        }
+                    });
+                    return;
+                }
+
+                showError((err && err.error) || `Upload failed (HTTP ${xhr.status})`);
             }
         });
 
@@ -532,6 +546,14 @@
             const res = await fetch(`/api/jobs/${state.jobId}`);
             if (!res.ok) {
                 const err = await res.json().catch(() => ({}));
+                if (err.challenge) {
+                    stopPolling();
+                    dom.progressLabel.textContent = 'Verifying your connection...';
+                    if (await solveChallenge(err.challenge)) {
+                        startPolling();
+                        return;
+                    }
+                }
                 showError(err.error || `Status check failed (HTTP ${res.status})`);
                 stopPolling();
                 return;
@@ -564,6 +586,54 @@
         }
     }
 
+    // solveChallenge finds the proof-of-work nonce in a Web Worker, so the
+    // page stays responsive, and redeems it while the challenge is still
+    // valid. It gives up once the challenge expires.
+    function solveChallenge(challenge) {
+        if (!challenge || challenge.algorithm !== 'sha256' || !window.Worker) {
+            return Promise.resolve(false);
+        }
+        const expiresAt = Date.parse(challenge.expires_at);
+
+        return new Promise((resolve) => {
+            const worker = new Worker('/pow-worker.js');
+            let timer = null;
+            const finish = (ok) => {
+                clearTimeout(timer);
+                worker.terminate();
+                resolve(ok);
+            };
+            if (!Number.isNaN(expiresAt)) {
+                timer = setTimeout(() => finish(false), Math.max(expiresAt - Date.now(), 0));
+            }
+
+            worker.onerror = () => finish(false);
+            worker.onmessage = async (e) => {
+                if (e.data.nonce === undefined) {
+                    dom.progressDetail.textContent =
+                        `Checked ${e.data.tried.toLocaleString()} candidates...`;
+                    return;
+                }
+                if (Date.now() >= expiresAt) {
+                    finish(false);
+                    return;
+                }
+                try {
+                    const res = await fetch('/api/challenge', {
+                        method: 'POST',
+                        headers: { 'Content-Type': 'application/json' },
+                        body: JSON.stringify({ token: challenge.token, nonce: e.data.nonce }),
+                    });
+                    finish(res.ok);
+                } catch (err) {
+                    finish(false);
+                }
+            };
+
+            worker.postMessage({ prefix: challenge.token + ':', difficulty: challenge.difficulty });
+        });
+    }
+
     function stopPolling() {
         if (state.pollTimer) {
             clearInterval(state.pollTimer);
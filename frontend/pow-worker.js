@@ -0,0 +1,140 @@
+// Proof-of-work solver, run as a Web Worker so the page stays responsive.
+// It looks for a nonce such that sha256(prefix + nonce) starts with
+// `difficulty` zero bits. Hashing is synchronous: crypto.subtle would cost a
+// promise per nonce. The prefix's full 64-byte blocks are hashed once, and
+// every nonce only hashes the last one or two blocks.
+'use strict';
+
+const K = new Int32Array([
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+]);
+
+const H0 = new Int32Array([
+    0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+]);
+
+// Nonces tried between progress messages.
+const BATCH = 100000;
+
+const W = new Int32Array(64);
+
+function compress(H, data, off) {
+    for (let i = 0; i < 16; i++) {
+        const j = off + i * 4;
+        W[i] = (data[j] << 24) | (data[j + 1] << 16) | (data[j + 2] << 8) | data[j + 3];
+    }
+    for (let i = 16; i < 64; i++) {
+        const w15 = W[i - 15];
+        const w2 = W[i - 2];
+        const s0 = ((w15 >>> 7) | (w15 << 25)) ^ ((w15 >>> 18) | (w15 << 14)) ^ (w15 >>> 3);
+        const s1 = ((w2 >>> 17) | (w2 << 15)) ^ ((w2 >>> 19) | (w2 << 13)) ^ (w2 >>> 10);
+        W[i] = (W[i - 16] + s0 + W[i - 7] + s1) | 0;
+    }
+
+    let a = H[0], b = H[1], c = H[2], d = H[3], e = H[4], f = H[5], g = H[6], h = H[7];
+    for (let i = 0; i < 64; i++) {
+        const S1 = ((e >>> 6) | (e << 26)) ^ ((e >>> 11) | (e << 21)) ^ ((e >>> 25) | (e << 7));
+        const ch = (e & f) ^ (~e & g);
+        const t1 = (h + S1 + ch + K[i] + W[i]) | 0;
+        const S0 = ((a >>> 2) | (a << 30)) ^ ((a >>> 13) | (a << 19)) ^ ((a >>> 22) | (a << 10));
+        const maj = (a & b) ^ (a & c) ^ (b & c);
+        const t2 = (S0 + maj) | 0;
+        h = g;
+        g = f;
+        f = e;
+        e = (d + t1) | 0;
+        d = c;
+        c = b;
+        b = a;
+        a = (t1 + t2) | 0;
+    }
+
+    H[0] = (H[0] + a) | 0;
+    H[1] = (H[1] + b) | 0;
+    H[2] = (H[2] + c) | 0;
+    H[3] = (H[3] + d) | 0;
+    H[4] = (H[4] + e) | 0;
+    H[5] = (H[5] + f) | 0;
+    H[6] = (H[6] + g) | 0;
+    H[7] = (H[7] + h) | 0;
+}
+
+function leadingZeroBits(H) {
+    let n = 0;
+    for (let i = 0; i < 8; i++) {
+        if (H[i] === 0) {
+            n += 32;
+            continue;
+        }
+        return n + Math.clz32(H[i]);
+    }
+    return n;
+}
+
+// makeHasher returns a function that hashes prefix + nonce into a reused
+// state and returns it.
+function makeHasher(prefix) {
+    const bytes = new TextEncoder().encode(prefix);
+    const full = bytes.length - (bytes.length % 64);
+
+    const mid = new Int32Array(H0);
+    for (let off = 0; off < full; off += 64) {
+        compress(mid, bytes, off);
+    }
+
+    const rest = bytes.subarray(full);
+    const buf = new Uint8Array(128);
+    const state = new Int32Array(8);
+
+    return function (nonce) {
+        const digits = String(nonce);
+        buf.set(rest, 0);
+        let n = rest.length;
+        for (let i = 0; i < digits.length; i++) {
+            buf[n++] = digits.charCodeAt(i);
+        }
+
+        const bits = (full + n) * 8;
+        buf[n++] = 0x80;
+        const end = n + 8 <= 64 ? 64 : 128;
+        buf.fill(0, n, end);
+        buf[end - 4] = bits >>> 24;
+        buf[end - 3] = bits >>> 16;
+        buf[end - 2] = bits >>> 8;
+        buf[end - 1] = bits;
+
+        state.set(mid);
+        compress(state, buf, 0);
+        if (end === 128) {
+            compress(state, buf, 64);
+        }
+        return state;
+    };
+}
+
+function solve(prefix, difficulty, progress) {
+    const hash = makeHasher(prefix);
+    for (let nonce = 0; ; nonce++) {
+        if (leadingZeroBits(hash(nonce)) >= difficulty) {
+            return nonce;
+        }
+        if (nonce % BATCH === BATCH - 1) {
+            progress(nonce + 1);
+        }
+    }
+}
+
+if (typeof self !== 'undefined' && typeof self.postMessage === 'function') {
+    self.onmessage = (e) => {
+        const { prefix, difficulty } = e.data;
+        const nonce = solve(prefix, difficulty, (tried) => self.postMessage({ tried }));
+        self.postMessage({ nonce: String(nonce) });
+    };
+}
@@ -1,11 +1,15 @@
 package config
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"fileforge/internal/operation"
 )
 
 type Config struct {
@@ -26,20 +30,65 @@ type Config struct {
 	RateLimitPerHour int
 	FlagThreshold    int
 
+	PowDifficulty        int
+	PowFlaggedDifficulty int
+	PowChallengeTTL      time.Duration
+	PowAllowance         time.Duration
+	PowAllowanceRequests int
+
 	MaxFileSize        int64
+	MaxBatchSize       int64
+	MaxBatchFiles      int
 	StoragePath        string
 	CleanupIntervalMin int
 	FileRetentionHours int
+	MaxRetentionHours  int
+	UploadExpiry       time.Duration
+
+	ResultCacheEnabled bool
+
+	PublicBaseURL       string
+	ShareLinkDefaultTTL time.Duration
+	ShareLinkMaxTTL     time.Duration
+
+	SyncMaxFileSize   int64
+	SyncTimeout       time.Duration
+	SyncMaxConcurrent int
+
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+
+	URLImportEnabled      bool
+	URLImportTimeout      time.Duration
+	URLImportMaxRedirects int
 
 	WorkerConcurrency int
 	RembgURL          string
 	TmpDir            string
 
+	AdminTokens       []AdminToken
+	AdminTLSPort      int
+	AdminTLSCertFile  string
+	AdminTLSKeyFile   string
+	AdminClientCAFile string
+
+	// Timeouts and Retries hold the operation registry's defaults, each
+	// overridable with TIMEOUT_<OPERATION> and RETRY_<GROUP>.
 	Timeouts map[string]time.Duration
 
 	Retries map[string]int
 }
 
+type AdminToken struct {
+	Name  string
+	Token string
+}
+
+func (c *Config) AdminMTLSEnabled() bool {
+	return c.AdminTLSPort > 0 && c.AdminTLSCertFile != "" &&
+		c.AdminTLSKeyFile != "" && c.AdminClientCAFile != ""
+}
+
 func (c *Config) DSN() string {
 	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
@@ -97,39 +146,93 @@ func Load() (*Config, error) {
 		RateLimitPerHour: envInt("RATE_LIMIT_PER_HOUR", 60),
 		FlagThreshold:    envInt("FLAG_THRESHOLD", 200),
 
+		PowDifficulty:        envInt("POW_DIFFICULTY", 18),
+		PowFlaggedDifficulty: envInt("POW_FLAGGED_DIFFICULTY", 20),
+		PowChallengeTTL:      secDuration(envInt("POW_CHALLENGE_TTL_SECONDS", 300)),
+		PowAllowance:         time.Duration(envInt("POW_ALLOWANCE_MINUTES", 30)) * time.Minute,
+		PowAllowanceRequests: envInt("POW_ALLOWANCE_REQUESTS", 30),
+
 		MaxFileSize:        envInt64("MAX_FILE_SIZE", 524288000), // 500MB default
+		MaxBatchSize:       envInt64("MAX_BATCH_SIZE", 1073741824),
+		MaxBatchFiles:      envInt("MAX_BATCH_FILES", 50),
 		StoragePath:        envStr("STORAGE_PATH", "/app/storage"),
 		CleanupIntervalMin: envInt("CLEANUP_INTERVAL_MINUTES", 10),
 		FileRetentionHours: envInt("FILE_RETENTION_HOURS", 24),
+		MaxRetentionHours:  envInt("MAX_RETENTION_HOURS", 168),
+		UploadExpiry:       time.Duration(envInt("UPLOAD_EXPIRY_HOURS", 24)) * time.Hour,
+
+		ResultCacheEnabled: envBool("RESULT_CACHE_ENABLED", true),
+
+		PublicBaseURL:       os.Getenv("PUBLIC_BASE_URL"),
+		ShareLinkDefaultTTL: time.Duration(envInt("SHARE_LINK_DEFAULT_HOURS", 24)) * time.Hour,
+		ShareLinkMaxTTL:     time.Duration(envInt("SHARE_LINK_MAX_HOURS", 168)) * time.Hour,
+
+		SyncMaxFileSize:   envInt64("SYNC_MAX_FILE_SIZE", 10485760),
+		SyncTimeout:       secDuration(envInt("SYNC_TIMEOUT_SECONDS", 20)),
+		SyncMaxConcurrent: envInt("SYNC_MAX_CONCURRENT", 8),
+
+		WebhookMaxAttempts: envInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookTimeout:     secDuration(envInt("WEBHOOK_TIMEOUT_SECONDS", 10)),
+
+		URLImportEnabled:      envBool("URL_IMPORT_ENABLED", true),
+		URLImportTimeout:      secDuration(envInt("URL_IMPORT_TIMEOUT_SECONDS", 60)),
+		URLImportMaxRedirects: envInt("URL_IMPORT_MAX_REDIRECTS", 5),
 
 		WorkerConcurrency: envInt("WORKER_CONCURRENCY", 4),
 		RembgURL:          envStr("REMBG_URL", "http://rembg:5000"),
 		TmpDir:            envStr("TMP_DIR", "/tmp/processing"),
 
-		Timeouts: map[string]time.Duration{
-			"image_convert":   secDuration(envInt("TIMEOUT_IMAGE_CONVERT", 120)),
-			"image_compress":  secDuration(envInt("TIMEOUT_IMAGE_COMPRESS", 120)),
-			"image_remove_bg": secDuration(envInt("TIMEOUT_IMAGE_REMOVE_BG", 180)),
-			"pdf_compress":    secDuration(envInt("TIMEOUT_PDF_COMPRESS", 300)),
-			"audio_convert":   secDuration(envInt("TIMEOUT_AUDIO_CONVERT", 300)),
-			"audio_compress":  secDuration(envInt("TIMEOUT_AUDIO_COMPRESS", 300)),
-			"video_compress":  secDuration(envInt("TIMEOUT_VIDEO_COMPRESS", 1800)),
-		},
-
-		Retries: map[string]int{
-			"image_convert":   envInt("RETRY_IMAGE", 2),
-			"image_compress":  envInt("RETRY_IMAGE", 2),
-			"image_remove_bg": envInt("RETRY_IMAGE", 2),
-			"pdf_compress":    envInt("RETRY_PDF", 2),
-			"audio_convert":   envInt("RETRY_AUDIO", 2),
-			"audio_compress":  envInt("RETRY_AUDIO", 2),
-			"video_compress":  envInt("RETRY_VIDEO", 1),
-		},
+		AdminTokens:       parseAdminTokens(os.Getenv("ADMIN_TOKENS")),
+		AdminTLSPort:      envInt("ADMIN_TLS_PORT", 0),
+		AdminTLSCertFile:  os.Getenv("ADMIN_TLS_CERT_FILE"),
+		AdminTLSKeyFile:   os.Getenv("ADMIN_TLS_KEY_FILE"),
+		AdminClientCAFile: os.Getenv("ADMIN_CLIENT_CA_FILE"),
+
+		Timeouts: make(map[string]time.Duration),
+		Retries:  make(map[string]int),
+	}
+
+	for _, spec := range operation.All() {
+		name := strings.ToUpper(spec.Name)
+		cfg.Timeouts[spec.Name] = secDuration(envInt("TIMEOUT_"+name, int(spec.Timeout/time.Second)))
+		cfg.Retries[spec.Name] = envInt("RETRY_"+strings.ToUpper(spec.Group), spec.Retries)
+	}
+
+	if cfg.MaxRetentionHours < cfg.FileRetentionHours {
+		return nil, fmt.Errorf("MAX_RETENTION_HOURS (%d) is below FILE_RETENTION_HOURS (%d)",
+			cfg.MaxRetentionHours, cfg.FileRetentionHours)
+	}
+
+	for _, t := range cfg.AdminTokens {
+		if len(t.Token) < 32 {
+			return nil, fmt.Errorf("ADMIN_TOKENS: token %q must be at least 32 characters", t.Name)
+		}
 	}
 
 	return cfg, nil
 }
 
+// parseAdminTokens reads a comma-separated list of "name:token" or bare
+// tokens. Bare tokens are named after a short hash so audit entries never
+// contain the secret itself.
+func parseAdminTokens(v string) []AdminToken {
+	var tokens []AdminToken
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(entry, ":")
+		if !ok {
+			token = entry
+			sum := sha256.Sum256([]byte(token))
+			name = "token-" + hex.EncodeToString(sum[:4])
+		}
+		tokens = append(tokens, AdminToken{Name: name, Token: token})
+	}
+	return tokens
+}
+
 
 func envStr(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
@@ -147,6 +250,15 @@ func envInt(key string, fallback int) int {
 	return fallback
 }
 
+func envBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
 func envInt64(key string, fallback int64) int64 {
 	if v := os.Getenv(key); v != "" {
 		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
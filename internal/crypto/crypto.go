@@ -3,9 +3,11 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 
@@ -36,6 +38,40 @@ func DeriveKey(masterKey []byte, jobID string) ([]byte, error) {
 	return key, nil
 }
 
+// DeriveOutputKey derives the key of a job's output. The per-job nonce is
+// mixed in so that discarding it shreds the output; jobs created before
+// nonces existed have none and share their input key.
+func DeriveOutputKey(masterKey []byte, jobID string, nonce []byte) ([]byte, error) {
+	if len(nonce) == 0 {
+		return DeriveKey(masterKey, jobID)
+	}
+	return DeriveKey(masterKey, jobID+":"+string(nonce))
+}
+
+func DeriveSubkey(masterKey []byte, purpose string) ([]byte, error) {
+	if len(masterKey) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(masterKey))
+	}
+
+	r := hkdf.New(sha256.New, masterKey, nil, []byte(hkdfInfo+":"+purpose))
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, fmt.Errorf("HKDF subkey derivation failed: %w", err)
+	}
+	return key, nil
+}
+
+// InputHasher returns a keyed hash for plaintext inputs. The key is scoped to
+// the session, so equal files uploaded by different sessions never produce
+// comparable hashes.
+func InputHasher(masterKey []byte, sessionID string) (hash.Hash, error) {
+	key, err := DeriveSubkey(masterKey, "input-hash:"+sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return hmac.New(sha256.New, key), nil
+}
+
 func EncryptStream(key []byte, src io.Reader, dst io.Writer) error {
 	block, err := aes.NewCipher(key)
 	if err != nil {
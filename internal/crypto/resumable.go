@@ -0,0 +1,231 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var ErrInconsistentUpload = errors.New("encrypted upload does not match the recorded offset")
+
+// ResumableWriter produces the same format as EncryptStream, but the stream
+// can be suspended between requests and resumed later at a known offset.
+//
+// Only complete 64 KB chunks are written to the destination, each sealed
+// exactly once with its position-derived nonce. A trailing partial chunk is
+// kept in a separate tail file, sealed with a fresh random nonce every time
+// it is saved and bound to the plaintext offset as additional data, so no
+// nonce is ever reused and a stale tail is detected on resume.
+type ResumableWriter struct {
+	gcm       cipher.AEAD
+	dst       *os.File
+	tailPath  string
+	baseNonce []byte
+	chunkIdx  uint32
+	buf       []byte
+}
+
+func ResumeEncrypt(key []byte, dstPath, tailPath string, offset int64) (*ResumableWriter, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes.NewCipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("cipher.NewGCM: %w", err)
+	}
+
+	w := &ResumableWriter{
+		gcm:      gcm,
+		tailPath: tailPath,
+		buf:      make([]byte, 0, chunkSize),
+	}
+
+	if offset == 0 {
+		return w, w.start(dstPath)
+	}
+	return w, w.resume(dstPath, offset)
+}
+
+func (w *ResumableWriter) start(dstPath string) error {
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("create dest %s: %w", dstPath, err)
+	}
+	w.dst = dst
+	os.Remove(w.tailPath)
+
+	w.baseNonce = make([]byte, nonceSize)
+	if _, err := rand.Read(w.baseNonce); err != nil {
+		dst.Close()
+		return fmt.Errorf("nonce generation: %w", err)
+	}
+	if _, err := dst.Write(w.baseNonce); err != nil {
+		dst.Close()
+		return fmt.Errorf("write nonce: %w", err)
+	}
+	return nil
+}
+
+func (w *ResumableWriter) resume(dstPath string, offset int64) error {
+	dst, err := os.OpenFile(dstPath, os.O_RDWR, 0666)
+	if err != nil {
+		return fmt.Errorf("open dest %s: %w", dstPath, err)
+	}
+	w.dst = dst
+
+	fail := func(err error) error {
+		dst.Close()
+		return err
+	}
+
+	w.baseNonce = make([]byte, nonceSize)
+	if _, err := io.ReadFull(dst, w.baseNonce); err != nil {
+		return fail(fmt.Errorf("read nonce: %w", err))
+	}
+
+	full := offset / chunkSize
+	partial := offset % chunkSize
+	if full > int64(^uint32(0)) {
+		return fail(fmt.Errorf("offset %d exceeds the chunk counter", offset))
+	}
+
+	expected := int64(nonceSize) + full*int64(chunkSize+tagSize)
+	info, err := dst.Stat()
+	if err != nil {
+		return fail(err)
+	}
+	// Chunks past the recorded offset (e.g. a crash before the offset was
+	// committed) cannot be dropped and sent again: the new plaintext would
+	// be sealed under nonces already used. The upload has to start over.
+	if info.Size() != expected {
+		return fail(ErrInconsistentUpload)
+	}
+	if _, err := dst.Seek(expected, io.SeekStart); err != nil {
+		return fail(fmt.Errorf("seek dest: %w", err))
+	}
+	w.chunkIdx = uint32(full)
+
+	if partial == 0 {
+		return nil
+	}
+
+	sealed, err := os.ReadFile(w.tailPath)
+	if err != nil || len(sealed) < nonceSize {
+		return fail(ErrInconsistentUpload)
+	}
+	tail, err := w.gcm.Open(w.buf[:0], sealed[:nonceSize], sealed[nonceSize:], offsetAAD(offset))
+	if err != nil || int64(len(tail)) != partial {
+		return fail(ErrInconsistentUpload)
+	}
+	w.buf = tail
+	return nil
+}
+
+// Offset is the number of plaintext bytes accepted so far.
+func (w *ResumableWriter) Offset() int64 {
+	return int64(w.chunkIdx)*chunkSize + int64(len(w.buf))
+}
+
+func (w *ResumableWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+
+		if len(w.buf) == chunkSize {
+			if err := w.sealChunk(); err != nil {
+				return written, err
+			}
+		}
+		written += n
+	}
+	return written, nil
+}
+
+func (w *ResumableWriter) sealChunk() error {
+	encrypted := w.gcm.Seal(nil, chunkNonce(w.baseNonce, w.chunkIdx), w.buf, nil)
+	if _, err := w.dst.Write(encrypted); err != nil {
+		return fmt.Errorf("write chunk %d: %w", w.chunkIdx, err)
+	}
+	w.chunkIdx++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Suspend flushes complete chunks, saves the partial chunk to the tail file
+// and closes the destination. The returned offset is what the caller should
+// record for the next ResumeEncrypt.
+func (w *ResumableWriter) Suspend() (int64, error) {
+	defer w.dst.Close()
+
+	if err := w.dst.Sync(); err != nil {
+		return 0, fmt.Errorf("sync dest: %w", err)
+	}
+
+	offset := w.Offset()
+	if len(w.buf) == 0 {
+		os.Remove(w.tailPath)
+		return offset, nil
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, fmt.Errorf("tail nonce generation: %w", err)
+	}
+	sealed := w.gcm.Seal(nonce, nonce, w.buf, offsetAAD(offset))
+
+	tmp := w.tailPath + ".tmp"
+	if err := writeFileSync(tmp, sealed); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, w.tailPath); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("save tail: %w", err)
+	}
+	return offset, nil
+}
+
+// Finish seals the partial chunk as the final chunk of the stream, removes
+// the tail file and closes the destination.
+func (w *ResumableWriter) Finish() error {
+	defer w.dst.Close()
+
+	if len(w.buf) > 0 {
+		if err := w.sealChunk(); err != nil {
+			return err
+		}
+	}
+	if err := w.dst.Sync(); err != nil {
+		return fmt.Errorf("sync dest: %w", err)
+	}
+	os.Remove(w.tailPath)
+	return nil
+}
+
+func offsetAAD(offset int64) []byte {
+	aad := make([]byte, 8)
+	binary.BigEndian.PutUint64(aad, uint64(offset))
+	return aad
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return f.Sync()
+}
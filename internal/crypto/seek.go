@@ -0,0 +1,153 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrCorruptCiphertext = errors.New("encrypted file has an invalid length")
+
+// DecryptReader gives random access to a file written by EncryptStream.
+// Each 64 KB chunk is sealed with a nonce derived from its index, so a seek
+// only needs to decrypt the chunk that contains the new position.
+type DecryptReader struct {
+	gcm       cipher.AEAD
+	src       io.ReaderAt
+	baseNonce []byte
+	size      int64
+	pos       int64
+
+	chunkIdx int64
+	chunk    []byte
+	encBuf   []byte
+}
+
+// NewDecryptReader wraps the encrypted file src of encSize bytes.
+func NewDecryptReader(key []byte, src io.ReaderAt, encSize int64) (*DecryptReader, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes.NewCipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("cipher.NewGCM: %w", err)
+	}
+
+	size, err := PlaintextSize(encSize)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DecryptReader{
+		gcm:      gcm,
+		src:      src,
+		size:     size,
+		chunkIdx: -1,
+		chunk:    make([]byte, 0, chunkSize),
+		encBuf:   make([]byte, chunkSize+tagSize),
+	}
+
+	if encSize > 0 {
+		d.baseNonce = make([]byte, nonceSize)
+		if _, err := src.ReadAt(d.baseNonce, 0); err != nil {
+			return nil, fmt.Errorf("read nonce: %w", err)
+		}
+	}
+	return d, nil
+}
+
+// PlaintextSize computes the decrypted length of an encrypted file from its
+// size on disk.
+func PlaintextSize(encSize int64) (int64, error) {
+	if encSize == 0 {
+		return 0, nil
+	}
+	if encSize < nonceSize {
+		return 0, ErrCorruptCiphertext
+	}
+
+	body := encSize - nonceSize
+	full := body / (chunkSize + tagSize)
+	rem := body % (chunkSize + tagSize)
+	if rem > 0 && rem <= tagSize {
+		return 0, ErrCorruptCiphertext
+	}
+
+	size := full * chunkSize
+	if rem > 0 {
+		size += rem - tagSize
+	}
+	return size, nil
+}
+
+// Size is the plaintext length.
+func (d *DecryptReader) Size() int64 {
+	return d.size
+}
+
+func (d *DecryptReader) Read(p []byte) (int, error) {
+	if d.pos >= d.size {
+		return 0, io.EOF
+	}
+
+	idx := d.pos / chunkSize
+	if idx != d.chunkIdx {
+		if err := d.loadChunk(idx); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.chunk[d.pos-idx*chunkSize:])
+	d.pos += int64(n)
+	return n, nil
+}
+
+func (d *DecryptReader) loadChunk(idx int64) error {
+	if idx > int64(^uint32(0)) {
+		return fmt.Errorf("chunk %d out of range", idx)
+	}
+
+	off := nonceSize + idx*(chunkSize+tagSize)
+	encLen := int64(chunkSize + tagSize)
+	if plainLeft := d.size - idx*chunkSize; plainLeft < chunkSize {
+		encLen = plainLeft + tagSize
+	}
+
+	buf := d.encBuf[:encLen]
+	if n, err := d.src.ReadAt(buf, off); err != nil && !(err == io.EOF && n == len(buf)) {
+		return fmt.Errorf("read chunk %d: %w", idx, err)
+	}
+
+	plain, err := d.gcm.Open(d.chunk[:0], chunkNonce(d.baseNonce, uint32(idx)), buf, nil)
+	if err != nil {
+		d.chunkIdx = -1
+		return fmt.Errorf("decrypt chunk %d: %w", idx, err)
+	}
+
+	d.chunk = plain
+	d.chunkIdx = idx
+	return nil
+}
+
+func (d *DecryptReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = d.pos + offset
+	case io.SeekEnd:
+		pos = d.size + offset
+	default:
+		return 0, fmt.Errorf("seek: invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return 0, fmt.Errorf("seek: negative position %d", pos)
+	}
+	d.pos = pos
+	return pos, nil
+}
@@ -0,0 +1,217 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Two full chunks and a partial third one.
+const testPlainSize = 2*chunkSize + 1000
+
+func testKey() []byte {
+	return bytes.Repeat([]byte{0x42}, 32)
+}
+
+func testPlaintext() []byte {
+	p := make([]byte, testPlainSize)
+	for i := range p {
+		p[i] = byte(i*7 + i>>11)
+	}
+	return p
+}
+
+func encrypt(t *testing.T, plain []byte) []byte {
+	t.Helper()
+	var enc bytes.Buffer
+	if err := EncryptStream(testKey(), bytes.NewReader(plain), &enc); err != nil {
+		t.Fatal(err)
+	}
+	return enc.Bytes()
+}
+
+func TestDecryptReaderSeek(t *testing.T) {
+	plain := testPlaintext()
+	enc := encrypt(t, plain)
+
+	tests := []struct {
+		name   string
+		pre    int // bytes read before seeking
+		offset int64
+		whence int
+		n      int // bytes to read after seeking, -1 for the rest
+		want   int64
+	}{
+		{"whole file", 0, 0, io.SeekStart, -1, 0},
+		{"inside first chunk", 0, 100, io.SeekStart, 200, 100},
+		{"across chunk boundary", 0, chunkSize - 10, io.SeekStart, 20, chunkSize - 10},
+		{"across both boundaries", 0, chunkSize - 1, io.SeekStart, chunkSize + 2, chunkSize - 1},
+		{"chunk start", 0, chunkSize, io.SeekStart, 100, chunkSize},
+		{"last partial chunk", 0, 2*chunkSize + 500, io.SeekStart, -1, 2*chunkSize + 500},
+		{"last byte", 0, -1, io.SeekEnd, -1, testPlainSize - 1},
+		{"back from later chunk", 2*chunkSize + 10, 10, io.SeekStart, 50, 10},
+		{"forward from current", 50, chunkSize, io.SeekCurrent, 100, chunkSize + 50},
+		{"backward from current", chunkSize + 5, -10, io.SeekCurrent, 20, chunkSize - 5},
+		{"at end", 0, 0, io.SeekEnd, -1, testPlainSize},
+		{"past end", 0, testPlainSize + 5, io.SeekStart, -1, testPlainSize + 5},
+		{"far past end", 0, 10 * chunkSize, io.SeekEnd, -1, testPlainSize + 10*chunkSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDecryptReader(testKey(), bytes.NewReader(enc), int64(len(enc)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Size() != testPlainSize {
+				t.Fatalf("Size() = %d, want %d", d.Size(), testPlainSize)
+			}
+
+			if tt.pre > 0 {
+				got := make([]byte, tt.pre)
+				if _, err := io.ReadFull(d, got); err != nil {
+					t.Fatalf("read before seek: %v", err)
+				}
+				if !bytes.Equal(got, plain[:tt.pre]) {
+					t.Fatal("read before seek returned wrong bytes")
+				}
+			}
+
+			pos, err := d.Seek(tt.offset, tt.whence)
+			if err != nil {
+				t.Fatalf("Seek: %v", err)
+			}
+			if pos != tt.want {
+				t.Fatalf("Seek = %d, want %d", pos, tt.want)
+			}
+
+			var got []byte
+			if tt.n < 0 {
+				got, err = io.ReadAll(d)
+			} else {
+				got = make([]byte, tt.n)
+				_, err = io.ReadFull(d, got)
+			}
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+
+			var want []byte
+			if pos < testPlainSize {
+				want = plain[pos:]
+				if tt.n >= 0 {
+					want = want[:tt.n]
+				}
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("read %d bytes at %d, want %d matching bytes", len(got), pos, len(want))
+			}
+
+			if n, err := d.Read(make([]byte, 1)); pos >= testPlainSize && (n != 0 || err != io.EOF) {
+				t.Errorf("read past end = %d, %v; want 0, EOF", n, err)
+			}
+		})
+	}
+}
+
+func TestDecryptReaderSeekInvalid(t *testing.T) {
+	enc := encrypt(t, testPlaintext())
+	d, err := NewDecryptReader(testKey(), bytes.NewReader(enc), int64(len(enc)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Seek(-1, io.SeekStart); err == nil {
+		t.Error("negative position accepted")
+	}
+	if _, err := d.Seek(0, 3); err == nil {
+		t.Error("invalid whence accepted")
+	}
+}
+
+func TestDecryptReaderTampered(t *testing.T) {
+	plain := testPlaintext()
+	enc := encrypt(t, plain)
+
+	const chunk = chunkSize + tagSize
+	tests := []struct {
+		name   string
+		flip   int   // index of the encrypted byte to corrupt
+		offset int64 // plaintext position to read from
+	}{
+		{"tag of first chunk", nonceSize + chunk - 1, 0},
+		{"tag of middle chunk", nonceSize + 2*chunk - 1, chunkSize + 100},
+		{"tag of last partial chunk", len(enc) - 1, 2*chunkSize + 10},
+		{"ciphertext of middle chunk", nonceSize + chunk + 5, chunkSize},
+		{"base nonce", 0, 2 * chunkSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bad := append([]byte(nil), enc...)
+			bad[tt.flip] ^= 0x01
+
+			d, err := NewDecryptReader(testKey(), bytes.NewReader(bad), int64(len(bad)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.Seek(tt.offset, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+
+			buf := make([]byte, 256)
+			n, err := d.Read(buf)
+			if err == nil {
+				t.Fatal("read of tampered chunk succeeded")
+			}
+			if n != 0 {
+				t.Errorf("read returned %d bytes with the error", n)
+			}
+			if !bytes.Equal(buf, make([]byte, len(buf))) {
+				t.Error("plaintext written to the buffer of a failed read")
+			}
+
+			// The chunk is not cached as if it had opened: retrying fails too.
+			if n, err := d.Read(buf); err == nil || n != 0 {
+				t.Errorf("second read = %d, %v; want an error", n, err)
+			}
+		})
+	}
+}
+
+func TestDecryptReaderStopsAtTamperedChunk(t *testing.T) {
+	plain := testPlaintext()
+	enc := encrypt(t, plain)
+	enc[nonceSize+chunkSize+tagSize+5] ^= 0x01
+
+	d, err := NewDecryptReader(testKey(), bytes.NewReader(enc), int64(len(enc)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(d)
+	if err == nil {
+		t.Fatal("reading through a tampered chunk succeeded")
+	}
+	if !bytes.Equal(got, plain[:chunkSize]) {
+		t.Errorf("got %d bytes before the error, want the %d of the intact first chunk", len(got), chunkSize)
+	}
+}
+
+func TestDecryptReaderInvalidSize(t *testing.T) {
+	enc := encrypt(t, testPlaintext())
+
+	// Cut into the tag of the last chunk: what is left cannot hold a chunk.
+	size := int64(len(enc) - 1000 - 1)
+	if _, err := NewDecryptReader(testKey(), bytes.NewReader(enc), size); !errors.Is(err, ErrCorruptCiphertext) {
+		t.Errorf("NewDecryptReader with %d bytes: err = %v, want ErrCorruptCiphertext", size, err)
+	}
+
+	d, err := NewDecryptReader(testKey(), bytes.NewReader(nil), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("read of empty file = %d, %v; want 0, EOF", n, err)
+	}
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"fileforge/internal/models"
+)
+
+type JobFilter struct {
+	Status    string
+	Operation string
+	SessionID string
+	Limit     int
+	Offset    int
+}
+
+func (db *DB) ListJobs(ctx context.Context, f JobFilter) ([]*models.Job, error) {
+	var where []string
+	var args []interface{}
+
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Status != "" {
+		add("status::TEXT = $%d", f.Status)
+	}
+	if f.Operation != "" {
+		add("operation::TEXT = $%d", f.Operation)
+	}
+	if f.SessionID != "" {
+		add("session_id = $%d", f.SessionID)
+	}
+
+	query := `SELECT ` + jobColumns + ` FROM jobs`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit, f.Offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := db.pool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return jobs, fmt.Errorf("scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+func (db *DB) ListSessions(ctx context.Context, flaggedOnly bool, limit, offset int) ([]*models.Session, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT `+sessionColumns+` FROM sessions
+		WHERE ($1 = FALSE OR is_flagged = TRUE)
+		ORDER BY last_request_at DESC, id
+		LIMIT $2 OFFSET $3
+	`, flaggedOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return sessions, fmt.Errorf("scan session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// UnflagIP clears the flag and the lifetime counter, otherwise the very next
+// request would push the session over the threshold again.
+func (db *DB) UnflagIP(ctx context.Context, ip string) (bool, error) {
+	res, err := db.pool.ExecContext(ctx, `
+		UPDATE sessions
+		SET is_flagged = FALSE, total_request_count = 0, hourly_request_count = 0
+		WHERE ip_address = $1
+	`, ip)
+	if err != nil {
+		return false, fmt.Errorf("unflag %s: %w", ip, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (db *DB) RetryJob(ctx context.Context, jobID string) (bool, error) {
+	res, err := db.pool.ExecContext(ctx, `
+		UPDATE jobs
+		SET status = 'pending',
+			retry_count = 0,
+			error_code = NULL,
+			error_message = NULL,
+			started_at = NULL,
+			completed_at = NULL
+		WHERE id = $1 AND status = 'failed'
+	`, jobID)
+	if err != nil {
+		return false, fmt.Errorf("retry job %s: %w", jobID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (db *DB) InsertAdminAudit(ctx context.Context, e models.AdminAuditEntry) error {
+	_, err := db.pool.ExecContext(ctx, `
+		INSERT INTO admin_audit_log (actor, method, path, status, remote_ip, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, e.Actor, e.Method, e.Path, e.Status, e.RemoteIP, e.RequestID)
+	if err != nil {
+		return fmt.Errorf("insert admin audit: %w", err)
+	}
+	return nil
+}
+
+// CleanupAdminAudit removes audit log entries older than age.
+func (db *DB) CleanupAdminAudit(ctx context.Context, age time.Duration) (int64, error) {
+	res, err := db.pool.ExecContext(ctx,
+		`DELETE FROM admin_audit_log WHERE created_at < $1`, time.Now().Add(-age))
+	if err != nil {
+		return 0, fmt.Errorf("cleanup admin audit: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (db *DB) ListAdminAudit(ctx context.Context, limit, offset int) ([]models.AdminAuditEntry, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT id, actor, method, path, status, COALESCE(remote_ip, ''),
+			   COALESCE(request_id, ''), created_at
+		FROM admin_audit_log
+		ORDER BY id DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("list admin audit: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AdminAuditEntry
+	for rows.Next() {
+		var e models.AdminAuditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Method, &e.Path, &e.Status,
+			&e.RemoteIP, &e.RequestID, &e.CreatedAt); err != nil {
+			return entries, fmt.Errorf("scan admin audit: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"fileforge/internal/models"
+)
+
+const apiKeyColumns = `id, name, key_prefix, webhook_secret, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(s scanner) (*models.APIKey, error) {
+	var k models.APIKey
+	err := s.Scan(&k.ID, &k.Name, &k.KeyPrefix, &k.WebhookSecret, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (db *DB) CreateAPIKey(ctx context.Context, name string, keyHash []byte, prefix, webhookSecret string) (*models.APIKey, error) {
+	row := db.pool.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, key_hash, key_prefix, webhook_secret)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+apiKeyColumns,
+		name, keyHash, prefix, webhookSecret)
+
+	k, err := scanAPIKey(row)
+	if err != nil {
+		return nil, fmt.Errorf("create api key: %w", err)
+	}
+	return k, nil
+}
+
+// GetActiveAPIKey looks up an unrevoked key by the SHA-256 of its value.
+func (db *DB) GetActiveAPIKey(ctx context.Context, keyHash []byte) (*models.APIKey, error) {
+	row := db.pool.QueryRowContext(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL
+	`, keyHash)
+
+	k, err := scanAPIKey(row)
+	if err != nil {
+		return nil, fmt.Errorf("get api key: %w", err)
+	}
+	return k, nil
+}
+
+// TouchAPIKey records use of a key, at most once a minute.
+func (db *DB) TouchAPIKey(ctx context.Context, keyID string) error {
+	_, err := db.pool.ExecContext(ctx, `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1
+		  AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, keyID)
+	if err != nil {
+		return fmt.Errorf("touch api key %s: %w", keyID, err)
+	}
+	return nil
+}
+
+func (db *DB) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	rows, err := db.pool.QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return keys, fmt.Errorf("scan api key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (db *DB) RevokeAPIKey(ctx context.Context, keyID string) (bool, error) {
+	res, err := db.pool.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1
+	`, keyID)
+	if err != nil {
+		return false, fmt.Errorf("revoke api key %s: %w", keyID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (db *DB) SetWebhookSecret(ctx context.Context, keyID, secret string) (*models.APIKey, error) {
+	row := db.pool.QueryRowContext(ctx, `
+		UPDATE api_keys SET webhook_secret = $2
+		WHERE id = $1
+		RETURNING `+apiKeyColumns,
+		keyID, secret)
+
+	k, err := scanAPIKey(row)
+	if err != nil {
+		return nil, fmt.Errorf("set webhook secret %s: %w", keyID, err)
+	}
+	return k, nil
+}
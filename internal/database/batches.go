@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fileforge/internal/models"
+)
+
+const batchColumns = `id, session_id, created_at, expires_at`
+
+func scanBatch(s scanner) (*models.Batch, error) {
+	var b models.Batch
+	if err := s.Scan(&b.ID, &b.SessionID, &b.CreatedAt, &b.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (db *DB) CreateBatch(ctx context.Context, sessionID string, retentionHours int) (*models.Batch, error) {
+	expiresAt := time.Now().Add(time.Duration(retentionHours) * time.Hour)
+
+	row := db.pool.QueryRowContext(ctx, `
+		INSERT INTO batches (session_id, expires_at)
+		VALUES ($1, $2)
+		RETURNING `+batchColumns,
+		sessionID, expiresAt)
+
+	b, err := scanBatch(row)
+	if err != nil {
+		return nil, fmt.Errorf("create batch: %w", err)
+	}
+	return b, nil
+}
+
+func (db *DB) GetBatch(ctx context.Context, batchID string) (*models.Batch, error) {
+	row := db.pool.QueryRowContext(ctx,
+		`SELECT `+batchColumns+` FROM batches WHERE id = $1`, batchID)
+
+	b, err := scanBatch(row)
+	if err != nil {
+		return nil, fmt.Errorf("get batch %s: %w", batchID, err)
+	}
+	return b, nil
+}
+
+func (db *DB) ListBatchJobs(ctx context.Context, batchID string) ([]*models.Job, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE batch_id = $1
+		ORDER BY created_at, id
+	`, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("list batch jobs %s: %w", batchID, err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return jobs, fmt.Errorf("scan batch job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// DeleteBatch removes the batch and its jobs, returning the deleted job IDs
+// so the caller can remove their files.
+func (db *DB) DeleteBatch(ctx context.Context, batchID string) ([]string, bool, error) {
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("delete batch %s: %w", batchID, err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`DELETE FROM jobs WHERE batch_id = $1 RETURNING id`, batchID)
+	if err != nil {
+		return nil, false, fmt.Errorf("delete batch jobs %s: %w", batchID, err)
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, false, fmt.Errorf("scan batch job id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("delete batch jobs %s: %w", batchID, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM batches WHERE id = $1`, batchID)
+	if err != nil {
+		return nil, false, fmt.Errorf("delete batch %s: %w", batchID, err)
+	}
+	n, _ := res.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("delete batch commit: %w", err)
+	}
+	return ids, n > 0, nil
+}
+
+// CleanupExpiredBatches removes expired batches whose jobs are already gone.
+// It runs after CleanupExpiredJobs so job files are never orphaned.
+func (db *DB) CleanupExpiredBatches(ctx context.Context) (int64, error) {
+	res, err := db.pool.ExecContext(ctx, `
+		DELETE FROM batches b
+		WHERE b.expires_at < NOW()
+		  AND NOT EXISTS (SELECT 1 FROM jobs j WHERE j.batch_id = b.id)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("cleanup expired batches: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ListCompletedJobs returns the unexpired completed jobs of a session, or of
+// one of its batches when batchID is set, oldest first.
+func (db *DB) ListCompletedJobs(ctx context.Context, sessionID, batchID string) ([]*models.Job, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE session_id = $1
+		  AND ($2 = '' OR batch_id = NULLIF($2, '')::UUID)
+		  AND status = 'completed'
+		  AND downloaded_at IS NULL
+		  AND expires_at > NOW()
+		ORDER BY created_at, id
+	`, sessionID, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("list completed jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return jobs, fmt.Errorf("scan completed job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
@@ -2,16 +2,19 @@ package database
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"fileforge/internal/models"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type DB struct {
@@ -64,9 +67,7 @@ func (db *DB) Ping(ctx context.Context) error {
 }
 
 func (db *DB) TouchSession(ctx context.Context, ip string, flagThreshold int) (*models.Session, error) {
-	var s models.Session
-
-	err := db.pool.QueryRowContext(ctx, `
+	row := db.pool.QueryRowContext(ctx, `
 		INSERT INTO sessions (ip_address, hourly_request_count, total_request_count)
 		VALUES ($1, 1, 1)
 		ON CONFLICT (ip_address) DO UPDATE SET
@@ -80,17 +81,13 @@ func (db *DB) TouchSession(ctx context.Context, ip string, flagThreshold int) (*
 				WHEN sessions.total_request_count + 1 >= $2 THEN TRUE
 				ELSE sessions.is_flagged
 			END
-		RETURNING id, ip_address::TEXT, created_at, last_request_at,
-				  hourly_request_count, total_request_count, is_flagged
-	`, ip, flagThreshold).Scan(
-		&s.ID, &s.IPAddress, &s.CreatedAt, &s.LastRequestAt,
-		&s.HourlyRequestCount, &s.TotalRequestCount, &s.IsFlagged,
-	)
+		RETURNING `+sessionColumns, ip, flagThreshold)
 
+	s, err := scanSession(row)
 	if err != nil {
 		return nil, fmt.Errorf("touch session: %w", err)
 	}
-	return &s, nil
+	return s, nil
 }
 
 func (db *DB) ResetHourlyCounts(ctx context.Context) (int64, error) {
@@ -106,56 +103,234 @@ func (db *DB) ResetHourlyCounts(ctx context.Context) (int64, error) {
 	return res.RowsAffected()
 }
 
+func (db *DB) ConsumeAllowance(ctx context.Context, sessionID string) (bool, error) {
+	res, err := db.pool.ExecContext(ctx, `
+		UPDATE sessions
+		SET pow_allowance_remaining = pow_allowance_remaining - 1
+		WHERE id = $1
+		  AND pow_allowance_remaining > 0
+		  AND pow_allowance_until > NOW()
+	`, sessionID)
+	if err != nil {
+		return false, fmt.Errorf("consume allowance %s: %w", sessionID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// RedeemChallenge records a solved challenge and grants the IP an allowance.
+// It returns false if the challenge was already redeemed.
+func (db *DB) RedeemChallenge(ctx context.Context, challengeID, ip string, challengeExpires time.Time, allowance time.Duration, requests int) (bool, error) {
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("redeem challenge: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO pow_redemptions (challenge_id, ip_address, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (challenge_id) DO NOTHING
+	`, challengeID, ip, challengeExpires)
+	if err != nil {
+		return false, fmt.Errorf("record redemption %s: %w", challengeID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sessions (ip_address, pow_allowance_until, pow_allowance_remaining)
+		VALUES ($1, NOW() + $2 * INTERVAL '1 second', $3)
+		ON CONFLICT (ip_address) DO UPDATE SET
+			pow_allowance_until = EXCLUDED.pow_allowance_until,
+			pow_allowance_remaining = EXCLUDED.pow_allowance_remaining
+	`, ip, int64(allowance/time.Second), requests)
+	if err != nil {
+		return false, fmt.Errorf("grant allowance for %s: %w", ip, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("redeem challenge commit: %w", err)
+	}
+	return true, nil
+}
+
+func (db *DB) CleanupRedemptions(ctx context.Context) (int64, error) {
+	res, err := db.pool.ExecContext(ctx,
+		`DELETE FROM pow_redemptions WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("cleanup redemptions: %w", err)
+	}
+	return res.RowsAffected()
+}
+
 type scanner interface {
 	Scan(dest ...interface{}) error
 }
 
-const jobColumns = `id, session_id, operation, status,
+const jobColumns = `id, session_id, batch_id, api_key_id, operation, status,
 	input_filename, output_filename, input_size, output_size,
-	original_name, params, file_nonce, error_message, retry_count,
+	original_name, detected_format, params, steps, input_hash, callback_url, file_nonce,
+	delete_after_download, downloaded_at, error_code, error_message, retry_count,
 	created_at, started_at, completed_at, expires_at`
 
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, p := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(p)
+	}
+	return strings.Join(parts, ", ")
+}
+
 func scanJob(s scanner) (*models.Job, error) {
 	var j models.Job
+	var steps []byte
 	err := s.Scan(
-		&j.ID, &j.SessionID, &j.Operation, &j.Status,
+		&j.ID, &j.SessionID, &j.BatchID, &j.APIKeyID, &j.Operation, &j.Status,
 		&j.InputFilename, &j.OutputFilename, &j.InputSize, &j.OutputSize,
-		&j.OriginalName, &j.Params, &j.FileNonce, &j.ErrorMessage, &j.RetryCount,
+		&j.OriginalName, &j.DetectedFormat, &j.Params, &steps, &j.InputHash, &j.CallbackURL, &j.FileNonce,
+		&j.DeleteAfterDownload, &j.DownloadedAt, &j.ErrorCode, &j.ErrorMessage, &j.RetryCount,
 		&j.CreatedAt, &j.StartedAt, &j.CompletedAt, &j.ExpiresAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if steps != nil {
+		if err := json.Unmarshal(steps, &j.Steps); err != nil {
+			return nil, fmt.Errorf("decode job %s steps: %w", j.ID, err)
+		}
+	}
 	return &j, nil
 }
 
+const sessionColumns = `id, ip_address::TEXT, created_at, last_request_at,
+	hourly_request_count, total_request_count, is_flagged,
+	pow_allowance_until, pow_allowance_remaining`
+
+func scanSession(s scanner) (*models.Session, error) {
+	var sess models.Session
+	err := s.Scan(
+		&sess.ID, &sess.IPAddress, &sess.CreatedAt, &sess.LastRequestAt,
+		&sess.HourlyRequestCount, &sess.TotalRequestCount, &sess.IsFlagged,
+		&sess.AllowanceUntil, &sess.AllowanceRemaining,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+var ErrIdempotencyConflict = errors.New("idempotency key already used")
+
 type CreateJobParams struct {
-	SessionID    string
-	Operation    string
-	OriginalName string
-	InputSize    int64
-	Params       models.JobParams
+	ID             string
+	SessionID      string
+	Operation      string
+	OriginalName   string
+	DetectedFormat string
+	InputSize      int64
+	Params         models.JobParams
+	BatchID        string
+	IdempotencyKey string
+	APIKeyID       string
+	CallbackURL    string
+	Steps          []models.PipelineStep
+
+	DeleteAfterDownload bool
 }
 
 func (db *DB) CreateJob(ctx context.Context, p CreateJobParams, retentionHours int) (*models.Job, error) {
-	jobID := uuid.New().String()
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create job: %w", err)
+	}
+	defer tx.Rollback()
+
+	job, err := insertJob(ctx, tx, p, retentionHours)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("create job commit: %w", err)
+	}
+	return job, nil
+}
+
+func insertJob(ctx context.Context, tx *sql.Tx, p CreateJobParams, retentionHours int) (*models.Job, error) {
+	jobID := p.ID
+	if jobID == "" {
+		jobID = uuid.New().String()
+	}
 
 	paramsJSON, err := json.Marshal(p.Params)
 	if err != nil {
 		return nil, fmt.Errorf("marshal params: %w", err)
 	}
 
+	// Plain jobs store NULL steps.
+	var stepsJSON interface{}
+	if len(p.Steps) > 0 {
+		raw, err := json.Marshal(p.Steps)
+		if err != nil {
+			return nil, fmt.Errorf("marshal steps: %w", err)
+		}
+		stepsJSON = raw
+	}
+
 	expiresAt := time.Now().Add(time.Duration(retentionHours) * time.Hour)
 
-	row := db.pool.QueryRowContext(ctx, `
-		INSERT INTO jobs (id, session_id, operation, input_filename, input_size, original_name, params, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	// The nonce salts the output's encryption key; clearing it shreds the
+	// output even if the file itself survives.
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate file nonce: %w", err)
+	}
+
+	row := tx.QueryRowContext(ctx, `
+		INSERT INTO jobs (id, session_id, batch_id, api_key_id, operation, input_filename, input_size, original_name, detected_format, params, steps, callback_url, file_nonce, delete_after_download, expires_at)
+		VALUES ($1, $2, NULLIF($3, '')::UUID, NULLIF($4, '')::UUID, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, NULLIF($12, ''), $13, $14, $15)
 		RETURNING `+jobColumns,
-		jobID, p.SessionID, p.Operation, jobID,
-		p.InputSize, p.OriginalName, paramsJSON, expiresAt,
+		jobID, p.SessionID, p.BatchID, p.APIKeyID, p.Operation, jobID,
+		p.InputSize, p.OriginalName, p.DetectedFormat, paramsJSON, stepsJSON, p.CallbackURL, nonce, p.DeleteAfterDownload, expiresAt,
 	)
 
-	return scanJob(row)
+	job, err := scanJob(row)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.IdempotencyKey != "" {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO idempotency_keys (session_id, key, job_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (session_id, key) DO NOTHING
+		`, p.SessionID, p.IdempotencyKey, jobID)
+		if err != nil {
+			return nil, fmt.Errorf("store idempotency key: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil, ErrIdempotencyConflict
+		}
+	}
+
+	return job, nil
+}
+
+func (db *DB) GetJobByIdempotencyKey(ctx context.Context, sessionID, key string) (*models.Job, error) {
+	row := db.pool.QueryRowContext(ctx, `
+		SELECT `+prefixColumns("j", jobColumns)+`
+		FROM idempotency_keys k
+		JOIN jobs j ON j.id = k.job_id
+		WHERE k.session_id = $1 AND k.key = $2
+	`, sessionID, key)
+
+	j, err := scanJob(row)
+	if err != nil {
+		return nil, fmt.Errorf("get job by idempotency key: %w", err)
+	}
+	return j, nil
 }
 
 func (db *DB) GetJob(ctx context.Context, jobID string) (*models.Job, error) {
@@ -169,6 +344,110 @@ func (db *DB) GetJob(ctx context.Context, jobID string) (*models.Job, error) {
 	return j, nil
 }
 
+// jobSortColumns are the orders ListSessionJobs supports. Each is paired
+// with id so rows with equal values still have a stable position.
+var jobSortColumns = map[string]string{
+	"created_at": "created_at",
+	"input_size": "input_size",
+}
+
+type SessionJobFilter struct {
+	SessionID string
+	Status    string
+	Operation string
+	SortBy    string
+	Desc      bool
+	// AfterValue and AfterID are the sort value and id of the last job of
+	// the previous page; AfterID is empty for the first page.
+	AfterValue interface{}
+	AfterID    string
+	Limit      int
+}
+
+// ListSessionJobs returns a page of a session's unexpired jobs using keyset
+// pagination, so pages stay consistent while new jobs arrive.
+func (db *DB) ListSessionJobs(ctx context.Context, f SessionJobFilter) ([]*models.Job, error) {
+	col, ok := jobSortColumns[f.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("list session jobs: unknown sort %q", f.SortBy)
+	}
+
+	where := []string{"session_id = $1", "expires_at > NOW()"}
+	args := []interface{}{f.SessionID}
+
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Status != "" {
+		add("status::TEXT = $%d", f.Status)
+	}
+	if f.Operation != "" {
+		add("operation = $%d", f.Operation)
+	}
+
+	dir, cmp := "ASC", ">"
+	if f.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if f.AfterID != "" {
+		args = append(args, f.AfterValue, f.AfterID)
+		where = append(where, fmt.Sprintf("(%s, id) %s ($%d, $%d::UUID)", col, cmp, len(args)-1, len(args)))
+	}
+
+	args = append(args, f.Limit)
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE ` + strings.Join(where, " AND ") +
+		fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT $%d", col, dir, dir, len(args))
+
+	rows, err := db.pool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list session jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return jobs, fmt.Errorf("scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// CountSessionJobs counts a session's unexpired jobs by status, optionally
+// restricted to one operation.
+func (db *DB) CountSessionJobs(ctx context.Context, sessionID, operation string) (map[string]int, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT status::TEXT, COUNT(*) FROM jobs
+		WHERE session_id = $1
+		  AND expires_at > NOW()
+		  AND ($2 = '' OR operation = $2)
+		GROUP BY status
+	`, sessionID, operation)
+	if err != nil {
+		return nil, fmt.Errorf("count session jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[string]int{
+		models.StatusPending:    0,
+		models.StatusProcessing: 0,
+		models.StatusCompleted:  0,
+		models.StatusFailed:     0,
+	}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("scan job count: %w", err)
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
 func (db *DB) UpdateJobStarted(ctx context.Context, jobID string) error {
 	_, err := db.pool.ExecContext(ctx, `
 		UPDATE jobs SET status = 'processing', started_at = NOW()
@@ -180,8 +459,10 @@ func (db *DB) UpdateJobStarted(ctx context.Context, jobID string) error {
 	return nil
 }
 
+// UpdateJobCompleted fails with sql.ErrNoRows if the job was deleted while
+// it was being processed.
 func (db *DB) UpdateJobCompleted(ctx context.Context, jobID, outputFilename string, outputSize int64) error {
-	_, err := db.pool.ExecContext(ctx, `
+	res, err := db.pool.ExecContext(ctx, `
 		UPDATE jobs
 		SET status = 'completed',
 			output_filename = $2,
@@ -192,23 +473,98 @@ func (db *DB) UpdateJobCompleted(ctx context.Context, jobID, outputFilename stri
 	if err != nil {
 		return fmt.Errorf("update job completed %s: %w", jobID, err)
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("update job completed %s: %w", jobID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (db *DB) SetJobInputHash(ctx context.Context, jobID string, inputHash []byte) error {
+	_, err := db.pool.ExecContext(ctx,
+		`UPDATE jobs SET input_hash = $2 WHERE id = $1`, jobID, inputHash)
+	if err != nil {
+		return fmt.Errorf("set input hash %s: %w", jobID, err)
+	}
 	return nil
 }
 
-func (db *DB) UpdateJobFailed(ctx context.Context, jobID, errorMsg string) error {
+// FindCachedResult returns the newest unexpired completed job of the same
+// session with an identical input hash, operation and parameters.
+func (db *DB) FindCachedResult(ctx context.Context, sessionID, operation string, params models.JobParams, inputHash []byte, excludeJobID string) (*models.Job, error) {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("marshal params: %w", err)
+	}
+
+	row := db.pool.QueryRowContext(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE session_id = $1
+		  AND input_hash = $2
+		  AND operation = $3
+		  AND params = $4::jsonb
+		  AND status = 'completed'
+		  AND NOT delete_after_download
+		  AND expires_at > NOW()
+		  AND id <> $5
+		ORDER BY completed_at DESC
+		LIMIT 1
+	`, sessionID, inputHash, operation, paramsJSON, excludeJobID)
+
+	j, err := scanJob(row)
+	if err != nil {
+		return nil, fmt.Errorf("find cached result: %w", err)
+	}
+	return j, nil
+}
+
+func (db *DB) CompleteJobFromCache(ctx context.Context, jobID, outputFilename string, outputSize int64, inputHash []byte) (*models.Job, error) {
+	row := db.pool.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET status = 'completed',
+			input_hash = $2,
+			output_filename = $3,
+			output_size = $4,
+			started_at = NOW(),
+			completed_at = NOW()
+		WHERE id = $1
+		RETURNING `+jobColumns,
+		jobID, inputHash, outputFilename, outputSize)
+
+	j, err := scanJob(row)
+	if err != nil {
+		return nil, fmt.Errorf("complete job from cache %s: %w", jobID, err)
+	}
+	return j, nil
+}
+
+func (db *DB) UpdateJobFailed(ctx context.Context, jobID, code, errorMsg string) error {
 	_, err := db.pool.ExecContext(ctx, `
 		UPDATE jobs
 		SET status = 'failed',
-			error_message = $2,
+			error_code = $2,
+			error_message = $3,
 			completed_at = NOW()
 		WHERE id = $1
-	`, jobID, errorMsg)
+	`, jobID, code, errorMsg)
 	if err != nil {
 		return fmt.Errorf("update job failed %s: %w", jobID, err)
 	}
 	return nil
 }
 
+// UpdateJobSteps saves the progress of a pipeline job's steps.
+func (db *DB) UpdateJobSteps(ctx context.Context, jobID string, steps []models.PipelineStep) error {
+	raw, err := json.Marshal(steps)
+	if err != nil {
+		return fmt.Errorf("marshal steps: %w", err)
+	}
+	_, err = db.pool.ExecContext(ctx, `UPDATE jobs SET steps = $2 WHERE id = $1`, jobID, raw)
+	if err != nil {
+		return fmt.Errorf("update job steps %s: %w", jobID, err)
+	}
+	return nil
+}
+
 func (db *DB) IncrementRetryCount(ctx context.Context, jobID string) (int, error) {
 	var count int
 	err := db.pool.QueryRowContext(ctx, `
@@ -222,6 +578,43 @@ func (db *DB) IncrementRetryCount(ctx context.Context, jobID string) (int, error
 	return count, nil
 }
 
+// ShredJobOutput discards the nonce of a job's output key and records the
+// download that triggered it. It reports false if the job was already
+// shredded, so concurrent downloads shred it only once.
+func (db *DB) ShredJobOutput(ctx context.Context, jobID string) (bool, error) {
+	res, err := db.pool.ExecContext(ctx, `
+		UPDATE jobs SET file_nonce = NULL, downloaded_at = NOW()
+		WHERE id = $1 AND downloaded_at IS NULL
+	`, jobID)
+	if err != nil {
+		return false, fmt.Errorf("shred job output %s: %w", jobID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+var ErrRetentionTooLong = errors.New("retention exceeds the maximum")
+
+// SetJobRetention makes a job expire hours from now, as long as that is no
+// later than maxHours after it was created.
+func (db *DB) SetJobRetention(ctx context.Context, jobID string, hours, maxHours int) (*models.Job, error) {
+	row := db.pool.QueryRowContext(ctx, `
+		UPDATE jobs SET expires_at = NOW() + make_interval(hours => $2)
+		WHERE id = $1
+		  AND NOW() + make_interval(hours => $2) <= created_at + make_interval(hours => $3)
+		RETURNING `+jobColumns,
+		jobID, hours, maxHours)
+
+	j, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRetentionTooLong
+	}
+	if err != nil {
+		return nil, fmt.Errorf("set job retention %s: %w", jobID, err)
+	}
+	return j, nil
+}
+
 func (db *DB) DeleteJob(ctx context.Context, jobID string) (bool, error) {
 	res, err := db.pool.ExecContext(ctx, `DELETE FROM jobs WHERE id = $1`, jobID)
 	if err != nil {
@@ -251,6 +644,30 @@ func (db *DB) CleanupExpiredJobs(ctx context.Context) ([]string, error) {
 }
 
 
+// OrphanedInputs returns those of ids that belong to neither a job nor a
+// resumable upload.
+func (db *DB) OrphanedInputs(ctx context.Context, ids []string) ([]string, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT f.id::text FROM unnest($1::uuid[]) AS f(id)
+		WHERE NOT EXISTS (SELECT 1 FROM jobs j WHERE j.id = f.id)
+		  AND NOT EXISTS (SELECT 1 FROM uploads u WHERE u.id = f.id)
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("find orphaned inputs: %w", err)
+	}
+	defer rows.Close()
+
+	var orphans []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return orphans, fmt.Errorf("scan orphaned input id: %w", err)
+		}
+		orphans = append(orphans, id)
+	}
+	return orphans, rows.Err()
+}
+
 func (db *DB) GetAdminStats(ctx context.Context) (*models.AdminStats, error) {
 	var s models.AdminStats
 
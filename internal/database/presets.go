@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"fileforge/internal/models"
+)
+
+var ErrPresetExists = errors.New("preset name already taken")
+
+const presetColumns = `id, api_key_id, name, operation, params, description, created_at`
+
+func scanPreset(s scanner) (*models.Preset, error) {
+	var p models.Preset
+	var params []byte
+	err := s.Scan(&p.ID, &p.APIKeyID, &p.Name, &p.Operation, &params, &p.Description, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(params, &p.Params); err != nil {
+		return nil, fmt.Errorf("decode preset %s params: %w", p.Name, err)
+	}
+	return &p, nil
+}
+
+// GetPreset returns the preset called name as seen by apiKeyID: the key's
+// own preset if it has one, otherwise the built-in. An empty apiKeyID only
+// sees built-ins.
+func (db *DB) GetPreset(ctx context.Context, apiKeyID, name string) (*models.Preset, error) {
+	row := db.pool.QueryRowContext(ctx, `
+		SELECT `+presetColumns+` FROM presets
+		WHERE name = $1 AND (api_key_id IS NULL OR api_key_id = NULLIF($2, '')::UUID)
+		ORDER BY api_key_id NULLS LAST
+		LIMIT 1
+	`, name, apiKeyID)
+
+	p, err := scanPreset(row)
+	if err != nil {
+		return nil, fmt.Errorf("get preset %s: %w", name, err)
+	}
+	return p, nil
+}
+
+// ListPresets returns the built-in presets and those of apiKeyID, by name.
+func (db *DB) ListPresets(ctx context.Context, apiKeyID string) ([]*models.Preset, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT `+presetColumns+` FROM presets
+		WHERE api_key_id IS NULL OR api_key_id = NULLIF($1, '')::UUID
+		ORDER BY name, api_key_id NULLS LAST
+	`, apiKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("list presets: %w", err)
+	}
+	defer rows.Close()
+
+	var presets []*models.Preset
+	for rows.Next() {
+		p, err := scanPreset(rows)
+		if err != nil {
+			return presets, fmt.Errorf("scan preset: %w", err)
+		}
+		presets = append(presets, p)
+	}
+	return presets, rows.Err()
+}
+
+// CreatePreset stores a custom preset of apiKeyID. It returns
+// ErrPresetExists if the key already has a preset of that name.
+func (db *DB) CreatePreset(ctx context.Context, apiKeyID, name, operation string, params map[string]string, description string) (*models.Preset, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("encode preset params: %w", err)
+	}
+
+	row := db.pool.QueryRowContext(ctx, `
+		INSERT INTO presets (api_key_id, name, operation, params, description)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (api_key_id, name) DO NOTHING
+		RETURNING `+presetColumns,
+		apiKeyID, name, operation, raw, description)
+
+	p, err := scanPreset(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPresetExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create preset %s: %w", name, err)
+	}
+	return p, nil
+}
+
+// DeletePreset removes a custom preset of apiKeyID. Built-ins cannot be
+// deleted.
+func (db *DB) DeletePreset(ctx context.Context, apiKeyID, name string) (bool, error) {
+	res, err := db.pool.ExecContext(ctx,
+		`DELETE FROM presets WHERE api_key_id = $1 AND name = $2`, apiKeyID, name)
+	if err != nil {
+		return false, fmt.Errorf("delete preset %s: %w", name, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
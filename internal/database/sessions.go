@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"fileforge/internal/models"
+)
+
+// SessionUsage totals a session's jobs, stored bytes, batches, unfinished
+// uploads and share links that can still be used.
+func (db *DB) SessionUsage(ctx context.Context, sessionID string) (*models.SessionUsage, error) {
+	u := &models.SessionUsage{Jobs: map[string]int{
+		models.StatusPending:    0,
+		models.StatusProcessing: 0,
+		models.StatusCompleted:  0,
+		models.StatusFailed:     0,
+	}}
+
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT status, COUNT(*), COALESCE(SUM(input_size), 0), COALESCE(SUM(output_size), 0)
+		FROM jobs
+		WHERE session_id = $1
+		GROUP BY status
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("session usage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var n int
+		var in, out int64
+		if err := rows.Scan(&status, &n, &in, &out); err != nil {
+			return nil, fmt.Errorf("scan session usage: %w", err)
+		}
+		u.Jobs[status] = n
+		u.InputBytes += in
+		u.OutputBytes += out
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("session usage: %w", err)
+	}
+
+	err = db.pool.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM batches WHERE session_id = $1),
+			(SELECT COUNT(*) FROM uploads WHERE session_id = $1 AND expires_at > NOW()),
+			(SELECT COUNT(*) FROM share_links
+			 WHERE session_id = $1
+			   AND revoked_at IS NULL
+			   AND expires_at > NOW()
+			   AND (max_downloads IS NULL OR download_count < max_downloads))
+	`, sessionID).Scan(&u.Batches, &u.PendingUploads, &u.ActiveShareLinks)
+	if err != nil {
+		return nil, fmt.Errorf("session usage: %w", err)
+	}
+	return u, nil
+}
+
+// ExportSessionJobs returns every job of a session, newest first, including
+// expired ones the cleanup loop has not removed yet.
+func (db *DB) ExportSessionJobs(ctx context.Context, sessionID string) ([]*models.Job, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE session_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("export session jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return jobs, fmt.Errorf("scan session job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// SessionErasure is what EraseSession removed. The caller still has to
+// delete the files of JobIDs and UploadIDs and stop ActiveJobIDs, the jobs
+// that were queued or running.
+type SessionErasure struct {
+	JobIDs       []string
+	ActiveJobIDs []string
+	UploadIDs    []string
+	Batches      int
+	ShareLinks   int
+	// LimitsKept reports that the IP was flagged or at its hourly limit, so
+	// that state was carried over to a fresh session row.
+	LimitsKept bool
+}
+
+// EraseSession deletes a session and everything recorded under it in one
+// transaction. The session row is locked first, so requests of the same
+// session cannot add jobs while it is being erased.
+//
+// If the IP is flagged or has used up rateLimit for the current hour, its
+// counters, flag and challenge allowance are carried over to a fresh session
+// so that erasure cannot be used to shed them. Otherwise nothing about the
+// IP is kept. Challenge redemptions stay until they expire, since they are
+// what stops a solved challenge from being replayed.
+func (db *DB) EraseSession(ctx context.Context, sessionID string, rateLimit int) (*SessionErasure, error) {
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erase session %s: %w", sessionID, err)
+	}
+	defer tx.Rollback()
+
+	var sess models.Session
+	err = tx.QueryRowContext(ctx, `
+		SELECT ip_address::TEXT, last_request_at, hourly_request_count, total_request_count, is_flagged,
+			pow_allowance_until, pow_allowance_remaining
+		FROM sessions WHERE id = $1
+		FOR UPDATE
+	`, sessionID).Scan(
+		&sess.IPAddress, &sess.LastRequestAt, &sess.HourlyRequestCount, &sess.TotalRequestCount, &sess.IsFlagged,
+		&sess.AllowanceUntil, &sess.AllowanceRemaining,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("erase session %s: %w", sessionID, err)
+	}
+
+	var e SessionErasure
+
+	// Deliveries outlive their job, and their payloads describe it.
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE job_id IN (SELECT id FROM jobs WHERE session_id = $1)
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("erase session %s webhooks: %w", sessionID, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM share_links WHERE session_id = $1`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("erase session %s share links: %w", sessionID, err)
+	}
+	n, _ := res.RowsAffected()
+	e.ShareLinks = int(n)
+
+	rows, err := tx.QueryContext(ctx,
+		`DELETE FROM jobs WHERE session_id = $1 RETURNING id, status`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("erase session %s jobs: %w", sessionID, err)
+	}
+	for rows.Next() {
+		var id, status string
+		if err := rows.Scan(&id, &status); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan erased job: %w", err)
+		}
+		e.JobIDs = append(e.JobIDs, id)
+		if status == models.StatusPending || status == models.StatusProcessing {
+			e.ActiveJobIDs = append(e.ActiveJobIDs, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erase session %s jobs: %w", sessionID, err)
+	}
+
+	res, err = tx.ExecContext(ctx, `DELETE FROM batches WHERE session_id = $1`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("erase session %s batches: %w", sessionID, err)
+	}
+	n, _ = res.RowsAffected()
+	e.Batches = int(n)
+
+	e.UploadIDs, err = deleteReturningIDs(ctx, tx, `DELETE FROM uploads WHERE session_id = $1 RETURNING id`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("erase session %s uploads: %w", sessionID, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1`, sessionID); err != nil {
+		return nil, fmt.Errorf("erase session %s: %w", sessionID, err)
+	}
+
+	hourActive := time.Since(sess.LastRequestAt) < time.Hour
+	if sess.IsFlagged || (hourActive && sess.HourlyRequestCount >= rateLimit) {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO sessions (ip_address, last_request_at, hourly_request_count, total_request_count, is_flagged,
+				pow_allowance_until, pow_allowance_remaining)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, sess.IPAddress, sess.LastRequestAt, sess.HourlyRequestCount, sess.TotalRequestCount, sess.IsFlagged,
+			sess.AllowanceUntil, sess.AllowanceRemaining)
+		if err != nil {
+			return nil, fmt.Errorf("erase session %s: carry over limits: %w", sessionID, err)
+		}
+		e.LimitsKept = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("erase session commit: %w", err)
+	}
+	return &e, nil
+}
+
+func deleteReturningIDs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"fileforge/internal/models"
+)
+
+const shareColumns = `id, job_id, session_id, max_downloads, download_count, created_at, expires_at, revoked_at`
+
+func scanShareLink(s scanner) (*models.ShareLink, error) {
+	var l models.ShareLink
+	err := s.Scan(
+		&l.ID, &l.JobID, &l.SessionID, &l.MaxDownloads, &l.DownloadCount,
+		&l.CreatedAt, &l.ExpiresAt, &l.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (db *DB) CreateShareLink(ctx context.Context, jobID, sessionID string, expiresAt time.Time, maxDownloads sql.NullInt32) (*models.ShareLink, error) {
+	row := db.pool.QueryRowContext(ctx, `
+		INSERT INTO share_links (job_id, session_id, expires_at, max_downloads)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+shareColumns,
+		jobID, sessionID, expiresAt, maxDownloads)
+
+	l, err := scanShareLink(row)
+	if err != nil {
+		return nil, fmt.Errorf("create share link: %w", err)
+	}
+	return l, nil
+}
+
+func (db *DB) GetShareLink(ctx context.Context, linkID string) (*models.ShareLink, error) {
+	row := db.pool.QueryRowContext(ctx,
+		`SELECT `+shareColumns+` FROM share_links WHERE id = $1`, linkID)
+
+	l, err := scanShareLink(row)
+	if err != nil {
+		return nil, fmt.Errorf("get share link %s: %w", linkID, err)
+	}
+	return l, nil
+}
+
+func (db *DB) ListShareLinks(ctx context.Context, jobID string) ([]*models.ShareLink, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT `+shareColumns+` FROM share_links
+		WHERE job_id = $1
+		ORDER BY created_at, id
+	`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("list share links %s: %w", jobID, err)
+	}
+	defer rows.Close()
+
+	var links []*models.ShareLink
+	for rows.Next() {
+		l, err := scanShareLink(rows)
+		if err != nil {
+			return links, fmt.Errorf("scan share link: %w", err)
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+func (db *DB) RevokeShareLink(ctx context.Context, jobID, linkID string) (bool, error) {
+	res, err := db.pool.ExecContext(ctx, `
+		UPDATE share_links SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1 AND job_id = $2
+	`, linkID, jobID)
+	if err != nil {
+		return false, fmt.Errorf("revoke share link %s: %w", linkID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ClaimShareDownload counts one download against the link and returns its
+// job ID. It fails with sql.ErrNoRows when the link is revoked, expired or
+// out of downloads, so concurrent requests can never exceed the limit.
+func (db *DB) ClaimShareDownload(ctx context.Context, linkID string) (string, error) {
+	var jobID string
+	err := db.pool.QueryRowContext(ctx, `
+		UPDATE share_links SET download_count = download_count + 1
+		WHERE id = $1
+		  AND revoked_at IS NULL
+		  AND expires_at > NOW()
+		  AND (max_downloads IS NULL OR download_count < max_downloads)
+		RETURNING job_id
+	`, linkID).Scan(&jobID)
+	if err != nil {
+		return "", fmt.Errorf("claim share download %s: %w", linkID, err)
+	}
+	return jobID, nil
+}
+
+// ReleaseShareDownload gives back a download claimed by a request that did
+// not end up sending the file.
+func (db *DB) ReleaseShareDownload(ctx context.Context, linkID string) error {
+	_, err := db.pool.ExecContext(ctx, `
+		UPDATE share_links SET download_count = download_count - 1
+		WHERE id = $1 AND download_count > 0
+	`, linkID)
+	if err != nil {
+		return fmt.Errorf("release share download %s: %w", linkID, err)
+	}
+	return nil
+}
+
+// CleanupExpiredShareLinks removes links that expired more than a day ago.
+func (db *DB) CleanupExpiredShareLinks(ctx context.Context) (int64, error) {
+	res, err := db.pool.ExecContext(ctx,
+		`DELETE FROM share_links WHERE expires_at < NOW() - INTERVAL '1 day'`)
+	if err != nil {
+		return 0, fmt.Errorf("cleanup share links: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"fileforge/internal/models"
+)
+
+const uploadColumns = `id, session_id, operation, original_name, COALESCE(detected_format, ''), params,
+	COALESCE(retention_hours, 0), delete_after_download, upload_length, upload_offset, created_at, updated_at, expires_at`
+
+func scanUpload(s scanner) (*models.Upload, error) {
+	var u models.Upload
+	var paramsJSON []byte
+	err := s.Scan(
+		&u.ID, &u.SessionID, &u.Operation, &u.OriginalName, &u.DetectedFormat, &paramsJSON,
+		&u.RetentionHours, &u.DeleteAfterDownload, &u.Length, &u.Offset, &u.CreatedAt, &u.UpdatedAt, &u.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(paramsJSON, &u.Params); err != nil {
+		return nil, fmt.Errorf("unmarshal upload params: %w", err)
+	}
+	return &u, nil
+}
+
+func (db *DB) CreateUpload(ctx context.Context, u *models.Upload, expiry time.Duration) (*models.Upload, error) {
+	paramsJSON, err := json.Marshal(u.Params)
+	if err != nil {
+		return nil, fmt.Errorf("marshal params: %w", err)
+	}
+
+	row := db.pool.QueryRowContext(ctx, `
+		INSERT INTO uploads (id, session_id, operation, original_name, params, retention_hours, delete_after_download, upload_length, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8, $9)
+		RETURNING `+uploadColumns,
+		u.ID, u.SessionID, u.Operation, u.OriginalName, paramsJSON,
+		u.RetentionHours, u.DeleteAfterDownload, u.Length, time.Now().Add(expiry),
+	)
+
+	created, err := scanUpload(row)
+	if err != nil {
+		return nil, fmt.Errorf("create upload: %w", err)
+	}
+	return created, nil
+}
+
+func (db *DB) GetUpload(ctx context.Context, uploadID string) (*models.Upload, error) {
+	row := db.pool.QueryRowContext(ctx,
+		`SELECT `+uploadColumns+` FROM uploads WHERE id = $1 AND expires_at > NOW()`, uploadID)
+
+	u, err := scanUpload(row)
+	if err != nil {
+		return nil, fmt.Errorf("get upload %s: %w", uploadID, err)
+	}
+	return u, nil
+}
+
+func (db *DB) UpdateUploadOffset(ctx context.Context, uploadID string, offset int64) error {
+	_, err := db.pool.ExecContext(ctx, `
+		UPDATE uploads SET upload_offset = $2, updated_at = NOW()
+		WHERE id = $1
+	`, uploadID, offset)
+	if err != nil {
+		return fmt.Errorf("update upload offset %s: %w", uploadID, err)
+	}
+	return nil
+}
+
+var ErrUploadBusy = errors.New("upload is locked by another request")
+
+// UploadLock is a session-level advisory lock on one upload. It lives on its
+// own connection, so it holds across every API instance for as long as a
+// chunk is being received, and is dropped by the server if the process dies.
+type UploadLock struct {
+	conn     *sql.Conn
+	uploadID string
+}
+
+// LockUpload takes the lock of uploadID without waiting. It returns
+// ErrUploadBusy if another request holds it.
+func (db *DB) LockUpload(ctx context.Context, uploadID string) (*UploadLock, error) {
+	conn, err := db.pool.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("lock upload %s: %w", uploadID, err)
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(ctx,
+		`SELECT pg_try_advisory_lock(hashtextextended($1, 0))`, uploadID).Scan(&locked)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("lock upload %s: %w", uploadID, err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, ErrUploadBusy
+	}
+	return &UploadLock{conn: conn, uploadID: uploadID}, nil
+}
+
+// Release drops the lock and returns the connection to the pool. If the
+// unlock fails the connection is discarded instead, which also drops it.
+func (l *UploadLock) Release(ctx context.Context) {
+	_, err := l.conn.ExecContext(ctx,
+		`SELECT pg_advisory_unlock(hashtextextended($1, 0))`, l.uploadID)
+	if err != nil {
+		l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	l.conn.Close()
+}
+
+// SetUploadFormat records the format sniffed from an upload's first chunk,
+// along with the parameters adjusted to it.
+func (db *DB) SetUploadFormat(ctx context.Context, uploadID, format string, params models.JobParams) error {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("marshal params: %w", err)
+	}
+
+	_, err = db.pool.ExecContext(ctx, `
+		UPDATE uploads SET detected_format = NULLIF($2, ''), params = $3, updated_at = NOW()
+		WHERE id = $1
+	`, uploadID, format, paramsJSON)
+	if err != nil {
+		return fmt.Errorf("set upload format %s: %w", uploadID, err)
+	}
+	return nil
+}
+
+func (db *DB) DeleteUpload(ctx context.Context, uploadID string) (bool, error) {
+	res, err := db.pool.ExecContext(ctx, `DELETE FROM uploads WHERE id = $1`, uploadID)
+	if err != nil {
+		return false, fmt.Errorf("delete upload %s: %w", uploadID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// CompleteUpload turns a finished upload into a job with the same ID. Both
+// happen in one transaction so the cleanup loop never sees the input file
+// as belonging to an abandoned upload.
+func (db *DB) CompleteUpload(ctx context.Context, uploadID string, p CreateJobParams, retentionHours int) (*models.Job, error) {
+	tx, err := db.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("complete upload %s: %w", uploadID, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM uploads WHERE id = $1`, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("complete upload %s: %w", uploadID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("complete upload %s: upload no longer exists", uploadID)
+	}
+
+	p.ID = uploadID
+	job, err := insertJob(ctx, tx, p, retentionHours)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("complete upload commit: %w", err)
+	}
+	return job, nil
+}
+
+// CleanupExpiredUploads removes abandoned partial uploads and returns their
+// IDs so the caller can remove the partially written files.
+func (db *DB) CleanupExpiredUploads(ctx context.Context) ([]string, error) {
+	rows, err := db.pool.QueryContext(ctx,
+		`DELETE FROM uploads WHERE expires_at < NOW() RETURNING id`)
+	if err != nil {
+		return nil, fmt.Errorf("cleanup expired uploads: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return ids, fmt.Errorf("scan expired upload id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
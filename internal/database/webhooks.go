@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fileforge/internal/models"
+)
+
+const webhookColumns = `id, job_id, api_key_id, event, url, payload, status, attempts,
+	next_attempt_at, last_status_code, last_error, created_at, delivered_at`
+
+func scanWebhookDelivery(s scanner, extra ...interface{}) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	dest := []interface{}{
+		&d.ID, &d.JobID, &d.APIKeyID, &d.Event, &d.URL, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt,
+	}
+	if err := s.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// DueWebhook is a claimed delivery together with the signing secret of its
+// API key, read at send time so a rotated secret applies to retries.
+type DueWebhook struct {
+	*models.WebhookDelivery
+	Secret     string
+	KeyRevoked bool
+}
+
+func (db *DB) InsertWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	_, err := db.pool.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (id, job_id, api_key_id, event, url, payload)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, d.ID, d.JobID, d.APIKeyID, d.Event, d.URL, []byte(d.Payload))
+	if err != nil {
+		return fmt.Errorf("insert webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries takes up to limit due deliveries and pushes their
+// next attempt out by lease, so another worker only picks one up again if
+// this one dies mid-delivery.
+func (db *DB) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*DueWebhook, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		FROM due, api_keys k
+		WHERE d.id = due.id AND k.id = d.api_key_id
+		RETURNING `+prefixColumns("d", webhookColumns)+`, k.webhook_secret, k.revoked_at IS NOT NULL
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var due []*DueWebhook
+	for rows.Next() {
+		var w DueWebhook
+		d, err := scanWebhookDelivery(rows, &w.Secret, &w.KeyRevoked)
+		if err != nil {
+			return due, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		w.WebhookDelivery = d
+		due = append(due, &w)
+	}
+	return due, rows.Err()
+}
+
+func (db *DB) MarkWebhookDelivered(ctx context.Context, id string, statusCode int) error {
+	_, err := db.pool.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', attempts = attempts + 1, last_status_code = $2,
+		    last_error = NULL, delivered_at = NOW()
+		WHERE id = $1
+	`, id, statusCode)
+	if err != nil {
+		return fmt.Errorf("mark webhook %s delivered: %w", id, err)
+	}
+	return nil
+}
+
+// MarkWebhookFailed records a failed attempt. When retryAt is zero the
+// delivery is given up on.
+func (db *DB) MarkWebhookFailed(ctx context.Context, id string, statusCode int, msg string, retryAt time.Time) error {
+	status := models.WebhookPending
+	if retryAt.IsZero() {
+		status = models.WebhookFailed
+		retryAt = time.Now()
+	}
+	_, err := db.pool.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, last_status_code = NULLIF($3, 0),
+		    last_error = $4, next_attempt_at = $5
+		WHERE id = $1
+	`, id, status, statusCode, msg, retryAt)
+	if err != nil {
+		return fmt.Errorf("mark webhook %s failed: %w", id, err)
+	}
+	return nil
+}
+
+type WebhookFilter struct {
+	Status string
+	JobID  string
+	Limit  int
+	Offset int
+}
+
+func (db *DB) ListWebhookDeliveries(ctx context.Context, f WebhookFilter) ([]*models.WebhookDelivery, error) {
+	rows, err := db.pool.QueryContext(ctx, `
+		SELECT `+webhookColumns+` FROM webhook_deliveries
+		WHERE ($1 = '' OR status::TEXT = $1)
+		  AND ($2 = '' OR job_id = NULLIF($2, '')::UUID)
+		ORDER BY created_at DESC, id
+		LIMIT $3 OFFSET $4
+	`, f.Status, f.JobID, f.Limit, f.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return out, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// ReplayWebhookDelivery puts a delivery back in the queue for immediate
+// sending with a fresh attempt budget.
+func (db *DB) ReplayWebhookDelivery(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	row := db.pool.QueryRowContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), delivered_at = NULL
+		WHERE id = $1
+		RETURNING `+webhookColumns,
+		id)
+
+	d, err := scanWebhookDelivery(row)
+	if err != nil {
+		return nil, fmt.Errorf("replay webhook %s: %w", id, err)
+	}
+	return d, nil
+}
+
+// CleanupWebhookDeliveries removes finished deliveries older than age.
+func (db *DB) CleanupWebhookDeliveries(ctx context.Context, age time.Duration) (int64, error) {
+	res, err := db.pool.ExecContext(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE status != 'pending' AND created_at < $1
+	`, time.Now().Add(-age))
+	if err != nil {
+		return 0, fmt.Errorf("cleanup webhook deliveries: %w", err)
+	}
+	return res.RowsAffected()
+}
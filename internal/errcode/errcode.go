@@ -0,0 +1,120 @@
+// Package errcode is the catalogue of machine-readable error codes. Every
+// JSON error response and every failed job carries one of these codes, so
+// clients can branch on a stable value instead of parsing messages. Codes
+// are never renamed or reused; new ones are only added.
+package errcode
+
+import "net/http"
+
+type Code string
+
+const (
+	BadRequest           Code = "bad_request"
+	InvalidParameter     Code = "invalid_parameter"
+	UnsupportedOperation Code = "unsupported_operation"
+	EmptyInput           Code = "empty_input"
+	InputTooLarge        Code = "input_too_large"
+	UnsupportedFormat    Code = "unsupported_format"
+	SourceFetchFailed    Code = "source_fetch_failed"
+	Unauthorized         Code = "unauthorized"
+	Forbidden            Code = "forbidden"
+	AccessRestricted     Code = "access_restricted"
+	NotFound             Code = "not_found"
+	Conflict             Code = "conflict"
+	IdempotencyConflict  Code = "idempotency_conflict"
+	JobNotReady          Code = "job_not_ready"
+	JobFailed            Code = "job_failed"
+	Gone                 Code = "gone"
+	RateLimited          Code = "rate_limited"
+	CorruptInput         Code = "corrupt_input"
+	ProcessingTimeout    Code = "processing_timeout"
+	ProcessingFailed     Code = "processing_failed"
+	Internal             Code = "internal_error"
+	Unavailable          Code = "service_unavailable"
+)
+
+// Entry describes one code. Status is the HTTP status it is returned with,
+// or 0 for codes that only appear on failed jobs. Message is the text shown
+// to users for failed jobs, whose internal diagnostics are only logged.
+type Entry struct {
+	Code    Code   `json:"code"`
+	Status  int    `json:"status,omitempty"`
+	Message string `json:"message"`
+}
+
+// Catalogue lists every code, in the order they are documented.
+var Catalogue = []Entry{
+	{BadRequest, http.StatusBadRequest, "The request is malformed."},
+	{InvalidParameter, http.StatusBadRequest, "A parameter is missing or has an invalid value."},
+	{UnsupportedOperation, http.StatusBadRequest, "The operation does not exist."},
+	{EmptyInput, http.StatusBadRequest, "The uploaded file is empty."},
+	{InputTooLarge, http.StatusRequestEntityTooLarge, "The file or request exceeds the size limit."},
+	{UnsupportedFormat, http.StatusUnsupportedMediaType, "The operation cannot take files of this format."},
+	{SourceFetchFailed, http.StatusBadGateway, "The file could not be fetched from source_url."},
+	{Unauthorized, http.StatusUnauthorized, "Credentials are missing or invalid."},
+	{Forbidden, http.StatusForbidden, "The caller may not access this resource."},
+	{AccessRestricted, http.StatusForbidden, "The session is restricted and must solve a challenge."},
+	{NotFound, http.StatusNotFound, "The resource does not exist or has expired."},
+	{Conflict, http.StatusConflict, "The resource is not in a state that allows this request."},
+	{IdempotencyConflict, http.StatusConflict, "A request with the same Idempotency-Key is still in progress."},
+	{JobNotReady, http.StatusConflict, "The job has not finished yet."},
+	{JobFailed, http.StatusUnprocessableEntity, "The job failed."},
+	{Gone, http.StatusGone, "The resource expired or was deleted after use."},
+	{RateLimited, http.StatusTooManyRequests, "Too many requests; retry later."},
+	{CorruptInput, 0, "The file is damaged or is not a valid file of its format."},
+	{ProcessingTimeout, 0, "Processing took longer than the time limit."},
+	{ProcessingFailed, 0, "The file could not be processed."},
+	{Internal, http.StatusInternalServerError, "An internal error occurred."},
+	{Unavailable, http.StatusServiceUnavailable, "The service is temporarily unavailable."},
+}
+
+var byCode = func() map[Code]Entry {
+	m := make(map[Code]Entry, len(Catalogue))
+	for _, e := range Catalogue {
+		m[e.Code] = e
+	}
+	return m
+}()
+
+// Message returns the user-facing message of c.
+func Message(c Code) string {
+	if e, ok := byCode[c]; ok {
+		return e.Message
+	}
+	return byCode[Internal].Message
+}
+
+// ForStatus returns the generic code of an HTTP status, used for errors
+// that were not given a more specific one.
+func ForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return BadRequest
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusConflict, http.StatusPreconditionFailed, http.StatusLocked:
+		return Conflict
+	case http.StatusGone:
+		return Gone
+	case http.StatusRequestEntityTooLarge:
+		return InputTooLarge
+	case http.StatusUnsupportedMediaType:
+		return UnsupportedFormat
+	case http.StatusUnprocessableEntity:
+		return JobFailed
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return SourceFetchFailed
+	case http.StatusServiceUnavailable:
+		return Unavailable
+	}
+	if status >= 500 {
+		return Internal
+	}
+	return BadRequest
+}
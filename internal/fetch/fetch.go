@@ -0,0 +1,254 @@
+// Package fetch downloads user-supplied URLs without letting them reach the
+// service's own network. Every connection is checked after DNS resolution,
+// so redirects and rebinding tricks cannot sneak in a private address.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidURL       = errors.New("invalid URL")
+	ErrForbiddenAddress = errors.New("address is not publicly routable")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrTooLarge         = errors.New("response exceeds size limit")
+	ErrTruncated        = errors.New("response ended early")
+	ErrTimeout          = errors.New("request timed out")
+	ErrUnexpectedStatus = errors.New("unexpected response status")
+)
+
+type Options struct {
+	MaxSize      int64
+	Timeout      time.Duration
+	MaxRedirects int
+	UserAgent    string
+
+	// AllowAddr decides whether a resolved address may be dialled. It
+	// defaults to PublicAddr; tests can relax it to reach httptest servers.
+	AllowAddr func(netip.Addr) bool
+}
+
+type Fetcher struct {
+	client *http.Client
+	opts   Options
+}
+
+// Response is an open download. Body fails with ErrTooLarge once MaxSize is
+// exceeded and must be closed, which also releases the fetch deadline.
+type Response struct {
+	Body        io.ReadCloser
+	URL         string
+	Filename    string
+	ContentType string
+	Size        int64
+}
+
+func New(opts Options) *Fetcher {
+	if opts.AllowAddr == nil {
+		opts.AllowAddr = PublicAddr
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = "FileForge-Fetch/1.0"
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+			}
+			if !opts.AllowAddr(ap.Addr().Unmap()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, ap.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > opts.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			return CheckURL(req.URL)
+		},
+	}
+
+	return &Fetcher{client: client, opts: opts}
+}
+
+// Client exposes the guarded HTTP client for other outbound calls to
+// user-supplied URLs.
+func (f *Fetcher) Client() *http.Client {
+	return f.client
+}
+
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (*Response, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	if err := CheckURL(u); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.opts.Timeout)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, ErrInvalidURL
+	}
+	req.Header.Set("User-Agent", f.opts.UserAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, unwrapURLError(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+	if resp.ContentLength > f.opts.MaxSize {
+		resp.Body.Close()
+		cancel()
+		return nil, ErrTooLarge
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	return &Response{
+		Body: &limitedBody{
+			rc:     resp.Body,
+			left:   f.opts.MaxSize,
+			cancel: cancel,
+		},
+		URL:         resp.Request.URL.String(),
+		Filename:    filename(resp),
+		ContentType: contentType,
+		Size:        resp.ContentLength,
+	}, nil
+}
+
+// CheckURL accepts absolute http(s) URLs without embedded credentials. It
+// does not resolve the host; that is checked when connecting.
+func CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be http or https", ErrInvalidURL)
+	}
+	if u.Host == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// unwrapURLError drops the *url.Error wrapper, whose message repeats the
+// URL, while keeping sentinel errors matchable.
+func unwrapURLError(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		if ue.Timeout() {
+			return ErrTimeout
+		}
+		return ue.Err
+	}
+	return err
+}
+
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+}
+
+// PublicAddr reports whether addr is a globally routable unicast address.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() ||
+		addr.IsLinkLocalUnicast() || addr.IsUnspecified() || addr.IsMulticast() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func filename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := path.Base(strings.ReplaceAll(params["filename"], "\\", "/")); name != "." && name != "/" {
+			return name
+		}
+	}
+	if name := path.Base(resp.Request.URL.Path); name != "." && name != "/" {
+		return name
+	}
+	return ""
+}
+
+type limitedBody struct {
+	rc     io.ReadCloser
+	left   int64
+	cancel context.CancelFunc
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.rc.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return n, ErrTooLarge
+	}
+	// A short body must not look like a clean end of stream to readers that
+	// treat io.ErrUnexpectedEOF as EOF.
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		err = ErrTruncated
+	case errors.Is(err, context.DeadlineExceeded):
+		err = ErrTimeout
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	err := b.rc.Close()
+	b.cancel()
+	return err
+}
@@ -17,27 +17,6 @@ const (
 )
 
 
-const (
-	OpImageConvert  = "image_convert"
-	OpImageCompress = "image_compress"
-	OpImageRemoveBG = "image_remove_bg"
-	OpPDFCompress   = "pdf_compress"
-	OpAudioConvert  = "audio_convert"
-	OpAudioCompress = "audio_compress"
-	OpVideoCompress = "video_compress"
-)
-
-var ValidOperations = map[string]bool{
-	OpImageConvert:  true,
-	OpImageCompress: true,
-	OpImageRemoveBG: true,
-	OpPDFCompress:   true,
-	OpAudioConvert:  true,
-	OpAudioCompress: true,
-	OpVideoCompress: true,
-}
-
-
 var MimeTypes = map[string]string{
 	// Images
 	"jpeg": "image/jpeg", "jpg": "image/jpeg",
@@ -58,6 +37,8 @@ var MimeTypes = map[string]string{
 	"mov": "video/quicktime",
 	// Document
 	"pdf": "application/pdf",
+	// Data
+	"json": "application/json",
 }
 
 func MimeForExtension(ext string) string {
@@ -69,57 +50,6 @@ func MimeForExtension(ext string) string {
 }
 
 
-var inputFormats = map[string][]string{
-	OpImageConvert:  {"jpeg", "jpg", "png", "webp", "tiff", "tif", "gif", "avif", "heif", "heic", "bmp"},
-	OpImageCompress: {"jpeg", "jpg", "png", "webp", "tiff", "tif", "gif", "avif", "heif", "heic", "bmp"},
-	OpImageRemoveBG: {"jpeg", "jpg", "png", "webp", "tiff", "tif", "bmp"},
-	OpPDFCompress:   {"pdf"},
-	OpAudioConvert:  {"mp3", "wav", "flac", "ogg", "opus", "aac", "m4a", "aiff", "wma"},
-	OpAudioCompress: {"mp3", "wav", "flac", "ogg", "opus", "aac", "m4a", "aiff", "wma"},
-	OpVideoCompress: {"mp4", "mkv", "webm", "avi", "mov"},
-}
-
-var outputFormats = map[string][]string{
-	OpImageConvert:  {"jpeg", "png", "webp", "tiff", "gif", "avif", "heif", "bmp"},
-	OpImageCompress: {}, // same as input
-	OpImageRemoveBG: {"png", "webp"},
-	OpPDFCompress:   {"pdf"},
-	OpAudioConvert:  {"mp3", "wav", "flac", "ogg", "opus", "aac", "m4a", "aiff"},
-	OpAudioCompress: {}, // same as input
-	OpVideoCompress: {"mp4", "mkv", "webm"},
-}
-
-func ValidInputFormat(operation, ext string) bool {
-	ext = strings.TrimPrefix(strings.ToLower(ext), ".")
-	formats, ok := inputFormats[operation]
-	if !ok {
-		return false
-	}
-	for _, f := range formats {
-		if f == ext {
-			return true
-		}
-	}
-	return false
-}
-
-func ValidOutputFormat(operation, ext string) bool {
-	ext = strings.TrimPrefix(strings.ToLower(ext), ".")
-	formats, ok := outputFormats[operation]
-	if !ok {
-		return false
-	}
-	if len(formats) == 0 {
-		return ValidInputFormat(operation, ext)
-	}
-	for _, f := range formats {
-		if f == ext {
-			return true
-		}
-	}
-	return false
-}
-
 type Session struct {
 	ID                 string    `json:"id"`
 	IPAddress          string    `json:"ip_address"`
@@ -128,11 +58,21 @@ type Session struct {
 	HourlyRequestCount int       `json:"hourly_request_count"`
 	TotalRequestCount  int       `json:"total_request_count"`
 	IsFlagged          bool      `json:"is_flagged"`
+
+	AllowanceUntil     sql.NullTime `json:"-"`
+	AllowanceRemaining int          `json:"-"`
+}
+
+func (s *Session) HasAllowance() bool {
+	return s.AllowanceRemaining > 0 &&
+		s.AllowanceUntil.Valid && s.AllowanceUntil.Time.After(time.Now())
 }
 
 type Job struct {
 	ID             string
 	SessionID      string
+	BatchID        sql.NullString
+	APIKeyID       sql.NullString
 	Operation      string
 	Status         string
 	InputFilename  string
@@ -140,20 +80,57 @@ type Job struct {
 	InputSize      int64
 	OutputSize     sql.NullInt64
 	OriginalName   string
+	DetectedFormat sql.NullString
 	Params         json.RawMessage
+	InputHash      []byte
+	CallbackURL    sql.NullString
 	FileNonce      []byte
-	ErrorMessage   sql.NullString
-	RetryCount     int
-	CreatedAt      time.Time
-	StartedAt      sql.NullTime
-	CompletedAt    sql.NullTime
-	ExpiresAt      time.Time
+	// Steps are the operations of a pipeline job, whose Operation is
+	// OperationPipeline and whose Params are those of the last step.
+	Steps []PipelineStep
+	// DeleteAfterDownload jobs have their output shredded once it has been
+	// downloaded in full; DownloadedAt records when that happened.
+	DeleteAfterDownload bool
+	DownloadedAt        sql.NullTime
+	ErrorCode           sql.NullString
+	ErrorMessage        sql.NullString
+	RetryCount          int
+	CreatedAt           time.Time
+	StartedAt           sql.NullTime
+	CompletedAt         sql.NullTime
+	ExpiresAt           time.Time
+}
+
+// OperationPipeline is the operation recorded for jobs that run several
+// operations in sequence.
+const OperationPipeline = "pipeline"
+
+// PipelineStep is one operation of a pipeline job. The worker fills in the
+// fields after Params as the step runs.
+type PipelineStep struct {
+	Operation    string     `json:"operation"`
+	Params       JobParams  `json:"params"`
+	Status       string     `json:"status"`
+	OutputSize   int64      `json:"output_size,omitempty"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	ErrorCode    string     `json:"error_code,omitempty"`
+	ErrorMessage string     `json:"error_message,omitempty"`
 }
 
 func (j *Job) InputExt() string {
 	return strings.TrimPrefix(strings.ToLower(filepath.Ext(j.OriginalName)), ".")
 }
 
+// InputFormat is the format sniffed from the input's content, falling back
+// to the original name's extension when the content matched no signature.
+func (j *Job) InputFormat() string {
+	if j.DetectedFormat.Valid {
+		return j.DetectedFormat.String
+	}
+	return j.InputExt()
+}
+
 func (j *Job) ToResponse() JobResponse {
 	resp := JobResponse{
 		ID:           j.ID,
@@ -162,8 +139,16 @@ func (j *Job) ToResponse() JobResponse {
 		InputSize:    j.InputSize,
 		OriginalName: j.OriginalName,
 		CreatedAt:    j.CreatedAt,
+		ExpiresAt:    j.ExpiresAt,
+
+		DeleteAfterDownload: j.DeleteAfterDownload,
+		Steps:               j.Steps,
 	}
 
+	if j.DetectedFormat.Valid {
+		v := j.DetectedFormat.String
+		resp.DetectedFormat = &v
+	}
 	if j.OutputSize.Valid {
 		v := j.OutputSize.Int64
 		resp.OutputSize = &v
@@ -172,6 +157,10 @@ func (j *Job) ToResponse() JobResponse {
 		v := j.OutputFilename.String
 		resp.OutputFilename = &v
 	}
+	if j.ErrorCode.Valid {
+		v := j.ErrorCode.String
+		resp.ErrorCode = &v
+	}
 	if j.ErrorMessage.Valid {
 		v := j.ErrorMessage.String
 		resp.ErrorMessage = &v
@@ -184,22 +173,83 @@ func (j *Job) ToResponse() JobResponse {
 		v := j.StartedAt.Time
 		resp.StartedAt = &v
 	}
+	if j.BatchID.Valid {
+		v := j.BatchID.String
+		resp.BatchID = &v
+	}
 
 	return resp
 }
 
 type JobResponse struct {
 	ID             string     `json:"id"`
+	BatchID        *string    `json:"batch_id,omitempty"`
 	Operation      string     `json:"operation"`
 	Status         string     `json:"status"`
 	InputSize      int64      `json:"input_size"`
 	OutputSize     *int64     `json:"output_size,omitempty"`
 	OriginalName   string     `json:"original_name"`
+	DetectedFormat *string    `json:"detected_format,omitempty"`
 	OutputFilename *string    `json:"output_filename,omitempty"`
+	ErrorCode      *string    `json:"error_code,omitempty"`
 	ErrorMessage   *string    `json:"error_message,omitempty"`
 	CreatedAt      time.Time  `json:"created_at"`
 	StartedAt      *time.Time `json:"started_at,omitempty"`
 	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+
+	DeleteAfterDownload bool           `json:"delete_after_download,omitempty"`
+	Steps               []PipelineStep `json:"steps,omitempty"`
+}
+
+// JobListResponse is a page of GET /api/jobs. Counts and Total cover all of
+// the session's jobs matching the operation filter, not just this page.
+type JobListResponse struct {
+	Jobs       []JobResponse  `json:"jobs"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Counts     map[string]int `json:"counts"`
+	Total      int            `json:"total"`
+}
+
+// UpdateJobRequest is the body of PATCH /api/jobs/{id}.
+type UpdateJobRequest struct {
+	// RetentionHours makes the job expire this many hours from now.
+	RetentionHours int `json:"retention_hours"`
+}
+
+// SessionUsage totals what a session has stored and done.
+type SessionUsage struct {
+	Jobs             map[string]int `json:"jobs"`
+	InputBytes       int64          `json:"input_bytes"`
+	OutputBytes      int64          `json:"output_bytes"`
+	Batches          int            `json:"batches"`
+	PendingUploads   int            `json:"pending_uploads"`
+	ActiveShareLinks int            `json:"active_share_links"`
+}
+
+// SessionExport is everything GET /api/session knows about the caller.
+type SessionExport struct {
+	Session    *Session      `json:"session"`
+	Usage      SessionUsage  `json:"usage"`
+	Jobs       []JobResponse `json:"jobs"`
+	ExportedAt time.Time     `json:"exported_at"`
+}
+
+// ErasureReceipt confirms what DELETE /api/session removed. LimitsKept is
+// set when the IP was flagged or rate limited and that state outlives the
+// erasure. Signature is an HMAC over the other fields, so the server can
+// later vouch for a receipt it issued.
+type ErasureReceipt struct {
+	ID            string    `json:"id"`
+	SessionID     string    `json:"session_id"`
+	ErasedAt      time.Time `json:"erased_at"`
+	Jobs          int       `json:"jobs"`
+	CancelledJobs int       `json:"cancelled_jobs"`
+	Batches       int       `json:"batches"`
+	Uploads       int       `json:"uploads"`
+	ShareLinks    int       `json:"share_links"`
+	LimitsKept    bool      `json:"limits_kept"`
+	Signature     string    `json:"signature"`
 }
 
 type AdminStats struct {
@@ -211,8 +261,292 @@ type AdminStats struct {
 	StorageUsedMB  int64 `json:"storage_used_mb"`
 }
 
+type ShareLink struct {
+	ID            string
+	JobID         string
+	SessionID     string
+	MaxDownloads  sql.NullInt32
+	DownloadCount int
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	RevokedAt     sql.NullTime
+}
+
+type ShareLinkResponse struct {
+	ID            string    `json:"id"`
+	JobID         string    `json:"job_id"`
+	URL           string    `json:"url"`
+	MaxDownloads  *int      `json:"max_downloads"`
+	DownloadCount int       `json:"download_count"`
+	Revoked       bool      `json:"revoked"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+func (l *ShareLink) ToResponse(url string) ShareLinkResponse {
+	resp := ShareLinkResponse{
+		ID:            l.ID,
+		JobID:         l.JobID,
+		URL:           url,
+		DownloadCount: l.DownloadCount,
+		Revoked:       l.RevokedAt.Valid,
+		CreatedAt:     l.CreatedAt,
+		ExpiresAt:     l.ExpiresAt,
+	}
+	if l.MaxDownloads.Valid {
+		v := int(l.MaxDownloads.Int32)
+		resp.MaxDownloads = &v
+	}
+	return resp
+}
+
+// Preset is a named set of request fields for one operation. Built-in
+// presets have no API key; custom ones belong to the key that created them
+// and take precedence over a built-in of the same name.
+type Preset struct {
+	ID          string
+	APIKeyID    sql.NullString
+	Name        string
+	Operation   string
+	Params      map[string]string
+	Description string
+	CreatedAt   time.Time
+}
+
+type PresetResponse struct {
+	Name        string            `json:"name"`
+	Operation   string            `json:"operation"`
+	Params      map[string]string `json:"params"`
+	Description string            `json:"description,omitempty"`
+	BuiltIn     bool              `json:"built_in"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+func (p *Preset) ToResponse() PresetResponse {
+	return PresetResponse{
+		Name:        p.Name,
+		Operation:   p.Operation,
+		Params:      p.Params,
+		Description: p.Description,
+		BuiltIn:     !p.APIKeyID.Valid,
+		CreatedAt:   p.CreatedAt,
+	}
+}
+
+type CreatePresetRequest struct {
+	Name        string            `json:"name"`
+	Operation   string            `json:"operation"`
+	Params      map[string]string `json:"params"`
+	Description string            `json:"description"`
+}
+
+type CreateShareRequest struct {
+	ExpiresInSeconds int  `json:"expires_in_seconds"`
+	MaxDownloads     *int `json:"max_downloads"`
+}
+
+type APIKey struct {
+	ID            string
+	Name          string
+	KeyPrefix     string
+	WebhookSecret string
+	CreatedAt     time.Time
+	LastUsedAt    sql.NullTime
+	RevokedAt     sql.NullTime
+}
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	KeyPrefix  string     `json:"key_prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	// Only returned when the key or secret is created or rotated.
+	Key           string `json:"key,omitempty"`
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+}
+
+func (k *APIKey) ToResponse() APIKeyResponse {
+	resp := APIKeyResponse{
+		ID:        k.ID,
+		Name:      k.Name,
+		KeyPrefix: k.KeyPrefix,
+		CreatedAt: k.CreatedAt,
+	}
+	if k.LastUsedAt.Valid {
+		v := k.LastUsedAt.Time
+		resp.LastUsedAt = &v
+	}
+	if k.RevokedAt.Valid {
+		v := k.RevokedAt.Time
+		resp.RevokedAt = &v
+	}
+	return resp
+}
+
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+
+	EventJobCompleted = "job.completed"
+	EventJobFailed    = "job.failed"
+)
+
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	JobID          *string         `json:"job_id"`
+	APIKeyID       string          `json:"api_key_id"`
+	Event          string          `json:"event"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// WebhookPayload is the JSON body POSTed to a job's callback_url.
+type WebhookPayload struct {
+	Event             string      `json:"event"`
+	DeliveryID        string      `json:"delivery_id"`
+	CreatedAt         time.Time   `json:"created_at"`
+	Job               JobResponse `json:"job"`
+	DownloadURL       string      `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time  `json:"download_expires_at,omitempty"`
+}
+
+// Upload is a resumable upload in progress. Its ID becomes the job ID once
+// all bytes have arrived.
+type Upload struct {
+	ID           string
+	SessionID    string
+	Operation    string
+	OriginalName string
+	// DetectedFormat is sniffed from the first chunk; empty until it arrives
+	// or when the content matched no signature.
+	DetectedFormat string
+	Params         JobParams
+	// RetentionHours is the job retention the client asked for; zero means
+	// the server default.
+	RetentionHours      int
+	DeleteAfterDownload bool
+	Length              int64
+	Offset              int64
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	ExpiresAt           time.Time
+}
+
+type Batch struct {
+	ID        string
+	SessionID string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type BatchResponse struct {
+	ID        string         `json:"id"`
+	Status    string         `json:"status"`
+	Total     int            `json:"total"`
+	Counts    map[string]int `json:"counts"`
+	CreatedAt time.Time      `json:"created_at"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	Jobs      []JobResponse  `json:"jobs"`
+}
+
+const BatchStatusPartial = "partial"
+
+// ToResponse aggregates the child jobs: the batch is pending until a job
+// starts, processing while any job is unfinished, and otherwise completed,
+// failed or partial depending on the terminal states of its children.
+func (b *Batch) ToResponse(jobs []*Job) BatchResponse {
+	resp := BatchResponse{
+		ID:        b.ID,
+		Total:     len(jobs),
+		CreatedAt: b.CreatedAt,
+		ExpiresAt: b.ExpiresAt,
+		Counts: map[string]int{
+			StatusPending:    0,
+			StatusProcessing: 0,
+			StatusCompleted:  0,
+			StatusFailed:     0,
+		},
+		Jobs: make([]JobResponse, 0, len(jobs)),
+	}
+
+	for _, j := range jobs {
+		resp.Counts[j.Status]++
+		resp.Jobs = append(resp.Jobs, j.ToResponse())
+	}
+
+	c := resp.Counts
+	switch {
+	case resp.Total == 0 || c[StatusPending] == resp.Total:
+		resp.Status = StatusPending
+	case c[StatusPending]+c[StatusProcessing] > 0:
+		resp.Status = StatusProcessing
+	case c[StatusCompleted] == resp.Total:
+		resp.Status = StatusCompleted
+	case c[StatusFailed] == resp.Total:
+		resp.Status = StatusFailed
+	default:
+		resp.Status = BatchStatusPartial
+	}
+
+	return resp
+}
+
+type AdminJobResponse struct {
+	JobResponse
+	SessionID  string          `json:"session_id"`
+	RetryCount int             `json:"retry_count"`
+	Params     json.RawMessage `json:"params"`
+}
+
+func (j *Job) ToAdminResponse() AdminJobResponse {
+	return AdminJobResponse{
+		JobResponse: j.ToResponse(),
+		SessionID:   j.SessionID,
+		RetryCount:  j.RetryCount,
+		Params:      j.Params,
+	}
+}
+
+type AdminAuditEntry struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	RemoteIP  string    `json:"remote_ip"`
+	RequestID string    `json:"request_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ErrorResponse is the body of every JSON error. Code is one of the codes
+// in the errcode catalogue; Error is a message meant for people.
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Code      string     `json:"code"`
+	Error     string     `json:"error"`
+	Challenge *Challenge `json:"challenge,omitempty"`
+}
+
+type Challenge struct {
+	Token      string    `json:"token"`
+	Algorithm  string    `json:"algorithm"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type ChallengeSolution struct {
+	Token string `json:"token"`
+	Nonce string `json:"nonce"`
 }
 
 
@@ -0,0 +1,36 @@
+package operation
+
+// Format is the public description of one operation served by
+// GET /api/formats.
+type Format struct {
+	Input []string `json:"input"`
+	// Output is either a list of formats or the string "same_as_input".
+	Output        any              `json:"output"`
+	DefaultOutput string           `json:"default_output,omitempty"`
+	Params        map[string]Param `json:"params,omitempty"`
+	Sync          bool             `json:"sync,omitempty"`
+}
+
+// Formats describes every operation, keyed by name.
+func Formats() map[string]Format {
+	out := make(map[string]Format, len(specs))
+	for _, s := range specs {
+		f := Format{
+			Input:         s.Input,
+			Output:        s.Output,
+			DefaultOutput: s.DefaultOutput,
+			Sync:          s.Sync,
+		}
+		if len(s.Output) == 0 {
+			f.Output = "same_as_input"
+		}
+		if len(s.schema) > 0 {
+			f.Params = make(map[string]Param, len(s.schema))
+			for _, p := range s.schema {
+				f.Params[p.Name] = p
+			}
+		}
+		out[s.Name] = f
+	}
+	return out
+}
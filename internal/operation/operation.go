@@ -0,0 +1,197 @@
+// Package operation is the single list of job operations. Each Spec declares
+// the formats, parameters, defaults and limits of one operation; request
+// validation, GET /api/formats, per-operation config and worker dispatch are
+// all derived from it. It has no cgo dependencies so the API can import it.
+package operation
+
+import (
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ImageConvert  = "image_convert"
+	ImageCompress = "image_compress"
+	ImageRemoveBG = "image_remove_bg"
+	PDFCompress   = "pdf_compress"
+	AudioConvert  = "audio_convert"
+	AudioCompress = "audio_compress"
+	VideoCompress = "video_compress"
+	Probe         = "probe"
+)
+
+var (
+	imageInputs = []string{"jpeg", "jpg", "png", "webp", "tiff", "tif", "gif", "avif", "heif", "heic", "bmp"}
+	audioInputs = []string{"mp3", "wav", "flac", "ogg", "opus", "aac", "m4a", "aiff", "wma"}
+	videoInputs = []string{"mp4", "mkv", "webm", "avi", "mov"}
+)
+
+var specs = []*Spec{
+	{
+		Name:    ImageConvert,
+		Group:   "image",
+		Input:   imageInputs,
+		Output:  []string{"jpeg", "png", "webp", "tiff", "gif", "avif", "heif", "bmp"},
+		Timeout: 120 * time.Second,
+		Retries: 2,
+		Sync:    true,
+	},
+	{
+		Name:    ImageCompress,
+		Group:   "image",
+		Input:   imageInputs,
+		Params:  ImageCompressParams{},
+		Timeout: 120 * time.Second,
+		Retries: 2,
+		Sync:    true,
+	},
+	{
+		Name:          ImageRemoveBG,
+		Group:         "image",
+		Input:         []string{"jpeg", "jpg", "png", "webp", "tiff", "tif", "bmp"},
+		Output:        []string{"png", "webp"},
+		DefaultOutput: "png",
+		Timeout:       180 * time.Second,
+		Retries:       2,
+	},
+	{
+		Name:          PDFCompress,
+		Group:         "pdf",
+		Input:         []string{"pdf"},
+		Output:        []string{"pdf"},
+		DefaultOutput: "pdf",
+		Params:        PDFCompressParams{},
+		Timeout:       300 * time.Second,
+		Retries:       2,
+	},
+	{
+		Name:    AudioConvert,
+		Group:   "audio",
+		Input:   audioInputs,
+		Output:  []string{"mp3", "wav", "flac", "ogg", "opus", "aac", "m4a", "aiff"},
+		Timeout: 300 * time.Second,
+		Retries: 2,
+	},
+	{
+		Name:    AudioCompress,
+		Group:   "audio",
+		Input:   audioInputs,
+		Params:  AudioCompressParams{},
+		Timeout: 300 * time.Second,
+		Retries: 2,
+	},
+	{
+		Name:          VideoCompress,
+		Group:         "video",
+		Input:         videoInputs,
+		Output:        []string{"mp4", "mkv", "webm"},
+		DefaultOutput: "mp4",
+		KeepInput:     true,
+		Params:        VideoCompressParams{},
+		Timeout:       1800 * time.Second,
+		Retries:       1,
+	},
+	{
+		// Probe writes the input's metadata as JSON; see internal/probe.
+		Name:          Probe,
+		Group:         "probe",
+		Input:         slices.Concat(imageInputs, []string{"pdf"}, audioInputs, videoInputs),
+		Output:        []string{"json"},
+		DefaultOutput: "json",
+		Timeout:       60 * time.Second,
+		Retries:       0,
+		Sync:          true,
+	},
+}
+
+var (
+	byName = make(map[string]*Spec, len(specs))
+	// knownParams holds every parameter name of any operation, so a field
+	// can be reported as inapplicable rather than unknown.
+	knownParams = map[string]bool{"output_format": true}
+)
+
+func init() {
+	for _, s := range specs {
+		if s.Params != nil {
+			s.schema = schemaOf(reflect.TypeOf(s.Params))
+		}
+		for _, p := range s.schema {
+			knownParams[p.Name] = true
+		}
+		byName[s.Name] = s
+	}
+}
+
+type Spec struct {
+	Name string
+	// Group names the RETRY_<GROUP> variable shared by related operations.
+	Group string
+	Input []string
+	// Output lists the formats the operation can produce. Empty means the
+	// output always has the input's format.
+	Output []string
+	// DefaultOutput is used when output_format is omitted. When both it and
+	// KeepInput are unset, output_format is required.
+	DefaultOutput string
+	// KeepInput prefers the input format over DefaultOutput when the input
+	// format is also a valid output.
+	KeepInput bool
+	// Params is the zero value of the operation's parameter struct, or nil
+	// if it takes none besides output_format.
+	Params  any
+	Timeout time.Duration
+	Retries int
+	// Sync operations are fast enough to run inside a POST /api/convert
+	// request.
+	Sync bool
+
+	schema []Param
+}
+
+// Get returns the spec for name, or nil if there is no such operation.
+func Get(name string) *Spec {
+	return byName[name]
+}
+
+// All returns every spec in declaration order.
+func All() []*Spec {
+	return specs
+}
+
+// Names returns the operation names sorted alphabetically.
+func Names() []string {
+	names := make([]string, 0, len(specs))
+	for _, s := range specs {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Spec) ValidInput(ext string) bool {
+	return contains(s.Input, trimExt(ext))
+}
+
+func (s *Spec) ValidOutput(ext string) bool {
+	if len(s.Output) == 0 {
+		return s.ValidInput(ext)
+	}
+	return contains(s.Output, trimExt(ext))
+}
+
+func trimExt(ext string) string {
+	return strings.TrimPrefix(strings.ToLower(ext), ".")
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
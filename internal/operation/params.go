@@ -0,0 +1,252 @@
+package operation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fileforge/internal/models"
+)
+
+// Parameter structs declare the options each operation accepts. The json
+// tag is the request field name; int fields take a min/max range or an enum
+// list, and default applies when the field is omitted. Their JSON encoding
+// must decode into models.JobParams, which is how jobs store parameters.
+
+type ImageCompressParams struct {
+	Quality  int  `json:"quality" min:"1" max:"100" default:"80"`
+	Lossless bool `json:"lossless"`
+}
+
+type PDFCompressParams struct {
+	ImageDPI     int `json:"image_dpi" enum:"72,150,300,600" default:"150"`
+	ImageQuality int `json:"image_quality" min:"1" max:"100" default:"75"`
+}
+
+type AudioCompressParams struct {
+	Quality  int  `json:"quality" min:"1" max:"100" default:"70"`
+	Lossless bool `json:"lossless"`
+}
+
+type VideoCompressParams struct {
+	Quality int `json:"quality" min:"1" max:"100" default:"65"`
+}
+
+type ParamType string
+
+const (
+	ParamRange  ParamType = "range"
+	ParamBool   ParamType = "bool"
+	ParamSelect ParamType = "select"
+)
+
+// Param is one field of a parameter struct as seen by clients.
+type Param struct {
+	Name    string    `json:"-"`
+	Type    ParamType `json:"type"`
+	Min     int       `json:"min,omitempty"`
+	Max     int       `json:"max,omitempty"`
+	Options []int     `json:"options,omitempty"`
+	Default any       `json:"default"`
+
+	index int
+}
+
+// ParamError reports a rejected request field.
+type ParamError struct {
+	Field string
+	Msg   string
+}
+
+func (e *ParamError) Error() string {
+	return e.Field + ": " + e.Msg
+}
+
+// schemaOf derives the parameter schema of a struct type. It panics on tags
+// it cannot interpret, so a bad declaration fails at startup.
+func schemaOf(t reflect.Type) []Param {
+	var params []Param
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			panic(fmt.Sprintf("operation: %s.%s has no json name", t.Name(), f.Name))
+		}
+		p := Param{Name: name, index: i}
+
+		switch f.Type.Kind() {
+		case reflect.Bool:
+			p.Type = ParamBool
+			p.Default = false
+
+		case reflect.Int:
+			def := mustAtoi(t, f, f.Tag.Get("default"))
+			p.Default = def
+			if enum := f.Tag.Get("enum"); enum != "" {
+				p.Type = ParamSelect
+				for _, o := range strings.Split(enum, ",") {
+					p.Options = append(p.Options, mustAtoi(t, f, o))
+				}
+			} else {
+				p.Type = ParamRange
+				p.Min = mustAtoi(t, f, f.Tag.Get("min"))
+				p.Max = mustAtoi(t, f, f.Tag.Get("max"))
+			}
+			if err := p.check(def); err != nil {
+				panic(fmt.Sprintf("operation: %s.%s default: %v", t.Name(), f.Name, err))
+			}
+
+		default:
+			panic(fmt.Sprintf("operation: %s.%s has unsupported type %s", t.Name(), f.Name, f.Type))
+		}
+		params = append(params, p)
+	}
+
+	// The stored form is models.JobParams; make sure every field survives.
+	raw, _ := json.Marshal(reflect.New(t).Interface())
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&models.JobParams{}); err != nil {
+		panic(fmt.Sprintf("operation: %s does not fit models.JobParams: %v", t.Name(), err))
+	}
+	return params
+}
+
+func mustAtoi(t reflect.Type, f reflect.StructField, s string) int {
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		panic(fmt.Sprintf("operation: %s.%s: bad tag value %q", t.Name(), f.Name, s))
+	}
+	return v
+}
+
+func (p *Param) check(v int) error {
+	if p.Type == ParamSelect {
+		for _, o := range p.Options {
+			if o == v {
+				return nil
+			}
+		}
+		opts := make([]string, len(p.Options))
+		for i, o := range p.Options {
+			opts[i] = strconv.Itoa(o)
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(opts, ", "))
+	}
+	if v < p.Min || v > p.Max {
+		return fmt.Errorf("must be between %d and %d", p.Min, p.Max)
+	}
+	return nil
+}
+
+func (p *Param) set(dst reflect.Value, raw string) error {
+	field := dst.Field(p.index)
+
+	if p.Type == ParamBool {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return &ParamError{Field: p.Name, Msg: "must be true or false"}
+		}
+		field.SetBool(v)
+		return nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return &ParamError{Field: p.Name, Msg: "must be an integer"}
+	}
+	if err := p.check(v); err != nil {
+		return &ParamError{Field: p.Name, Msg: err.Error()}
+	}
+	field.SetInt(int64(v))
+	return nil
+}
+
+// Resolve validates the parameter fields of a request for an input of
+// format inputExt and returns the job parameters. Fields the operation does
+// not declare are rejected. inputExt and output_format are expected to be
+// normalized already (jpg → jpeg).
+func (s *Spec) Resolve(fields map[string]string, inputExt string) (models.JobParams, error) {
+	var p models.JobParams
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "output_format" && len(s.Output) > 0 {
+			continue
+		}
+		if s.param(name) == nil {
+			if knownParams[name] {
+				return p, &ParamError{Field: name, Msg: "does not apply to " + s.Name}
+			}
+			return p, &ParamError{Field: name, Msg: "unknown parameter"}
+		}
+	}
+
+	out := strings.TrimSpace(fields["output_format"])
+	switch {
+	case len(s.Output) == 0:
+		out = inputExt
+	case out != "":
+		if !s.ValidOutput(out) {
+			return p, &ParamError{Field: "output_format",
+				Msg: fmt.Sprintf("must be one of %s", strings.Join(s.Output, ", "))}
+		}
+	case s.KeepInput && s.ValidOutput(inputExt):
+		out = inputExt
+	case s.DefaultOutput != "":
+		out = s.DefaultOutput
+	default:
+		return p, &ParamError{Field: "output_format", Msg: "is required for " + s.Name}
+	}
+
+	if s.Params != nil {
+		typed := reflect.New(reflect.TypeOf(s.Params)).Elem()
+		for i := range s.schema {
+			param := &s.schema[i]
+			raw := strings.TrimSpace(fields[param.Name])
+			if raw == "" {
+				if def, ok := param.Default.(int); ok {
+					typed.Field(param.index).SetInt(int64(def))
+				}
+				continue
+			}
+			if err := param.set(typed, raw); err != nil {
+				return p, err
+			}
+		}
+
+		raw, err := json.Marshal(typed.Interface())
+		if err != nil {
+			return p, fmt.Errorf("encode params: %w", err)
+		}
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return p, fmt.Errorf("decode params: %w", err)
+		}
+	}
+
+	p.OutputFormat = out
+	return p, nil
+}
+
+// Schema returns the declared parameters of the operation, excluding
+// output_format.
+func (s *Spec) Schema() []Param {
+	return s.schema
+}
+
+func (s *Spec) param(name string) *Param {
+	for i := range s.schema {
+		if s.schema[i].Name == name {
+			return &s.schema[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+
+	"fileforge/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	Algorithm = "sha256"
+
+	maxNonceLen = 64
+)
+
+var (
+	ErrInvalidToken     = errors.New("invalid challenge token")
+	ErrExpired          = errors.New("challenge expired")
+	ErrWrongSubject     = errors.New("challenge was issued to a different client")
+	ErrInsufficientWork = errors.New("solution does not meet the required difficulty")
+)
+
+type claims struct {
+	ID   string `json:"id"`
+	Sub  string `json:"sub"`
+	Bits int    `json:"bits"`
+	Exp  int64  `json:"exp"`
+}
+
+// Solved describes a challenge whose solution has been verified.
+type Solved struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// Issue creates a stateless challenge bound to subject (the client IP).
+// The token is HMAC-signed, so nothing is stored until it is redeemed.
+func Issue(key []byte, subject string, difficulty int, ttl time.Duration) models.Challenge {
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+
+	payload, _ := json.Marshal(claims{
+		ID:   uuid.New().String(),
+		Sub:  subject,
+		Bits: difficulty,
+		Exp:  expiresAt.Unix(),
+	})
+
+	enc := base64.RawURLEncoding
+	token := enc.EncodeToString(payload) + "." + enc.EncodeToString(sign(key, payload))
+
+	return models.Challenge{
+		Token:      token,
+		Algorithm:  Algorithm,
+		Difficulty: difficulty,
+		ExpiresAt:  expiresAt,
+	}
+}
+
+// Verify checks the token signature, expiry and subject, then checks that
+// sha256(token + ":" + nonce) starts with the required number of zero bits.
+func Verify(key []byte, subject, token, nonce string) (*Solved, error) {
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(payloadPart)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := enc.DecodeString(sigPart)
+	if err != nil || !hmac.Equal(sig, sign(key, payload)) {
+		return nil, ErrInvalidToken
+	}
+
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	expiresAt := time.Unix(c.Exp, 0)
+	if time.Now().After(expiresAt) {
+		return nil, ErrExpired
+	}
+	if c.Sub != subject {
+		return nil, ErrWrongSubject
+	}
+
+	if nonce == "" || len(nonce) > maxNonceLen {
+		return nil, fmt.Errorf("%w: nonce must be 1-%d characters", ErrInsufficientWork, maxNonceLen)
+	}
+
+	sum := sha256.Sum256([]byte(token + ":" + nonce))
+	if leadingZeroBits(sum[:]) < c.Bits {
+		return nil, ErrInsufficientWork
+	}
+
+	return &Solved{ID: c.ID, ExpiresAt: expiresAt}, nil
+}
+
+func sign(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, x := range b {
+		if x != 0 {
+			return n + bits.LeadingZeros8(x)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,191 @@
+// Package probe holds the metadata returned by POST /api/probe and the
+// parsers for the tool output it is built from. Running the tools is left to
+// the worker's processor package; everything here is plain Go.
+package probe
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Result describes one input file. Exactly one of Image, Media and PDF is
+// set, depending on the kind of file.
+type Result struct {
+	Format string `json:"format"`
+	Size   int64  `json:"size"`
+	Image  *Image `json:"image,omitempty"`
+	Media  *Media `json:"media,omitempty"`
+	PDF    *PDF   `json:"pdf,omitempty"`
+}
+
+type Image struct {
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	ColorSpace  string            `json:"color_space"`
+	Channels    int               `json:"channels"`
+	Alpha       bool              `json:"alpha"`
+	ICCProfile  bool              `json:"icc_profile"`
+	Orientation int               `json:"orientation,omitempty"`
+	Frames      int               `json:"frames"`
+	EXIF        map[string]string `json:"exif,omitempty"`
+}
+
+type Media struct {
+	Container string   `json:"container"`
+	Duration  float64  `json:"duration_seconds"`
+	BitRate   int64    `json:"bit_rate,omitempty"`
+	Streams   []Stream `json:"streams"`
+}
+
+type Stream struct {
+	Index    int     `json:"index"`
+	Type     string  `json:"type"`
+	Codec    string  `json:"codec"`
+	Profile  string  `json:"profile,omitempty"`
+	BitRate  int64   `json:"bit_rate,omitempty"`
+	Duration float64 `json:"duration_seconds,omitempty"`
+	Language string  `json:"language,omitempty"`
+
+	// Video
+	Width     int     `json:"width,omitempty"`
+	Height    int     `json:"height,omitempty"`
+	FrameRate float64 `json:"frame_rate,omitempty"`
+	PixFmt    string  `json:"pixel_format,omitempty"`
+
+	// Audio
+	SampleRate    int    `json:"sample_rate,omitempty"`
+	Channels      int    `json:"channels,omitempty"`
+	ChannelLayout string `json:"channel_layout,omitempty"`
+}
+
+type PDF struct {
+	Version    string `json:"version"`
+	Pages      int    `json:"pages,omitempty"`
+	Encrypted  bool   `json:"encrypted"`
+	Linearized bool   `json:"linearized"`
+}
+
+// ffprobeOutput mirrors `ffprobe -print_format json -show_format
+// -show_streams`. ffprobe prints most numbers as strings.
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		Index         int               `json:"index"`
+		CodecType     string            `json:"codec_type"`
+		CodecName     string            `json:"codec_name"`
+		Profile       string            `json:"profile"`
+		BitRate       string            `json:"bit_rate"`
+		Duration      string            `json:"duration"`
+		Width         int               `json:"width"`
+		Height        int               `json:"height"`
+		AvgFrameRate  string            `json:"avg_frame_rate"`
+		PixFmt        string            `json:"pix_fmt"`
+		SampleRate    string            `json:"sample_rate"`
+		Channels      int               `json:"channels"`
+		ChannelLayout string            `json:"channel_layout"`
+		Tags          map[string]string `json:"tags"`
+	} `json:"streams"`
+}
+
+// ParseFFprobe reads the JSON printed by
+// `ffprobe -print_format json -show_format -show_streams`.
+func ParseFFprobe(out []byte) (*Media, error) {
+	var raw ffprobeOutput
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("parse ffprobe output: %w", err)
+	}
+
+	m := &Media{
+		Container: raw.Format.FormatName,
+		Duration:  parseFloat(raw.Format.Duration),
+		BitRate:   parseInt(raw.Format.BitRate),
+		Streams:   make([]Stream, 0, len(raw.Streams)),
+	}
+	for _, s := range raw.Streams {
+		st := Stream{
+			Index:         s.Index,
+			Type:          s.CodecType,
+			Codec:         s.CodecName,
+			BitRate:       parseInt(s.BitRate),
+			Duration:      parseFloat(s.Duration),
+			Language:      s.Tags["language"],
+			Width:         s.Width,
+			Height:        s.Height,
+			FrameRate:     parseRate(s.AvgFrameRate),
+			PixFmt:        s.PixFmt,
+			SampleRate:    int(parseInt(s.SampleRate)),
+			Channels:      s.Channels,
+			ChannelLayout: s.ChannelLayout,
+		}
+		if s.Profile != "unknown" {
+			st.Profile = s.Profile
+		}
+		if st.Language == "und" {
+			st.Language = ""
+		}
+		m.Streams = append(m.Streams, st)
+	}
+	return m, nil
+}
+
+// ParseQPDFCheck reads the report printed by `qpdf --check`.
+func ParseQPDFCheck(out string) (*PDF, error) {
+	p := &PDF{}
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "PDF Version:"):
+			p.Version = strings.TrimSpace(strings.TrimPrefix(line, "PDF Version:"))
+		case line == "File is not encrypted":
+			p.Encrypted = false
+		case strings.HasPrefix(line, "R = "), line == "File is encrypted":
+			p.Encrypted = true
+		case line == "File is linearized":
+			p.Linearized = true
+		}
+	}
+	if p.Version == "" {
+		return nil, fmt.Errorf("parse qpdf output: no PDF version reported")
+	}
+	return p, nil
+}
+
+// ParsePageCount reads the number printed by `qpdf --show-npages`.
+func ParsePageCount(out string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("parse page count: %w", err)
+	}
+	return n, nil
+}
+
+func parseInt(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
+
+func parseFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+// parseRate turns ffprobe's "30000/1001" into frames per second.
+func parseRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		return parseFloat(s)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return float64(int(parseFloat(num)/d*1000+0.5)) / 1000
+}
@@ -19,7 +19,7 @@ func runCommand(ctx context.Context, name string, args ...string) (string, error
 	err := cmd.Run()
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("operation timed out")
+			return "", fmt.Errorf("operation timed out: %w", ctx.Err())
 		}
 		if ctx.Err() == context.Canceled {
 			return "", ctx.Err()
@@ -0,0 +1,46 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrCorruptInput marks failures caused by an input that is damaged or is
+// not really in the format it claims to be. Retrying such a job cannot
+// succeed.
+var ErrCorruptInput = errors.New("corrupt input")
+
+// corruptMarkers are fragments of the messages ffmpeg, qpdf, Ghostscript,
+// pngquant and libvips print when they cannot parse their input.
+var corruptMarkers = []string{
+	"invalid data found when processing input",
+	"moov atom not found",
+	"could not find codec parameters",
+	"can't find pdf header",
+	"file is damaged",
+	"unable to find trailer",
+	"premature end of",
+	"not a known file format",
+	"unsupported image format",
+	"not a png file",
+	"truncated",
+	"corrupt",
+}
+
+// Classify wraps err with ErrCorruptInput when its message shows that the
+// input could not be parsed. Other errors are returned unchanged.
+func Classify(err error) error {
+	if err == nil || errors.Is(err, ErrCorruptInput) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range corruptMarkers {
+		if strings.Contains(msg, m) {
+			return fmt.Errorf("%w: %w", ErrCorruptInput, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"fileforge/internal/models"
+	"fileforge/internal/probe"
+
+	"github.com/h2non/bimg"
+)
+
+// Probe inspects inputPath and writes its metadata to outputPath as JSON.
+// The input's extension is its sniffed format.
+func Probe(ctx context.Context, inputPath, outputPath string) error {
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return fmt.Errorf("stat input: %w", err)
+	}
+
+	format := strings.TrimPrefix(filepath.Ext(inputPath), ".")
+	res := &probe.Result{Format: format, Size: info.Size()}
+
+	mime := models.MimeForExtension(format)
+	switch {
+	case strings.HasPrefix(mime, "image/"):
+		res.Image, err = probeImage(ctx, inputPath, format)
+	case mime == "application/pdf":
+		res.PDF, err = probePDF(ctx, inputPath)
+	case strings.HasPrefix(mime, "audio/"), strings.HasPrefix(mime, "video/"):
+		res.Media, err = probeMedia(ctx, inputPath)
+	default:
+		err = fmt.Errorf("cannot probe .%s files", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		return fmt.Errorf("encode probe result: %w", err)
+	}
+	return os.WriteFile(outputPath, out, 0600)
+}
+
+func probeImage(ctx context.Context, inputPath, format string) (*probe.Image, error) {
+	buf, err := bimg.Read(inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("read image: %w", err)
+	}
+
+	meta, err := bimg.Metadata(buf)
+	if err != nil {
+		return nil, fmt.Errorf("read image metadata: %w", err)
+	}
+
+	img := &probe.Image{
+		Width:       meta.Size.Width,
+		Height:      meta.Size.Height,
+		ColorSpace:  meta.Space,
+		Channels:    meta.Channels,
+		Alpha:       meta.Alpha,
+		ICCProfile:  meta.Profile,
+		Orientation: meta.Orientation,
+		Frames:      1,
+		EXIF:        exifFields(meta.EXIF),
+	}
+
+	// bimg does not expose libvips' n-pages, so animation is counted here.
+	switch format {
+	case "webp":
+		if n := webpFrames(buf); n > 0 {
+			img.Frames = n
+		}
+	case "gif", "png":
+		if n, err := countPackets(ctx, inputPath); err == nil && n > 0 {
+			img.Frames = n
+		}
+	}
+	return img, nil
+}
+
+// exifFields flattens the EXIF tags libvips found, skipping empty ones and
+// the maker note, which is an opaque vendor blob.
+func exifFields(exif bimg.EXIF) map[string]string {
+	fields := make(map[string]string)
+	v := reflect.ValueOf(exif)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if name == "MakerNote" {
+			continue
+		}
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			if s := strings.TrimSpace(f.String()); s != "" {
+				fields[name] = s
+			}
+		case reflect.Int:
+			if f.Int() != 0 {
+				fields[name] = strconv.FormatInt(f.Int(), 10)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// webpFrames counts ANMF chunks in an animated WebP, or returns 0 if the
+// file is not animated.
+func webpFrames(buf []byte) int {
+	if len(buf) < 12 || string(buf[0:4]) != "RIFF" || string(buf[8:12]) != "WEBP" {
+		return 0
+	}
+	frames := 0
+	for off := 12; off+8 <= len(buf); {
+		id := string(buf[off : off+4])
+		size := int(binary.LittleEndian.Uint32(buf[off+4 : off+8]))
+		if id == "ANMF" {
+			frames++
+		}
+		off += 8 + size + size%2
+	}
+	return frames
+}
+
+// countPackets counts the frames of an animated GIF or APNG.
+func countPackets(ctx context.Context, inputPath string) (int, error) {
+	out, err := runCommand(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-count_packets",
+		"-show_entries", "stream=nb_read_packets",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		inputPath,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(out))
+}
+
+func probeMedia(ctx context.Context, inputPath string) (*probe.Media, error) {
+	out, err := runCommand(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		inputPath,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe: %w", err)
+	}
+	return probe.ParseFFprobe([]byte(out))
+}
+
+func probePDF(ctx context.Context, inputPath string) (*probe.PDF, error) {
+	out, err := runCommand(ctx, "qpdf", "--warning-exit-0", "--check", inputPath)
+	if err != nil {
+		// Files locked with a user password cannot be opened at all; report
+		// what the header says.
+		if strings.Contains(err.Error(), "invalid password") {
+			return &probe.PDF{Version: pdfHeaderVersion(inputPath), Encrypted: true}, nil
+		}
+		return nil, fmt.Errorf("qpdf check: %w", err)
+	}
+
+	pdf, err := probe.ParseQPDFCheck(out)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err = runCommand(ctx, "qpdf", "--warning-exit-0", "--show-npages", inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("qpdf page count: %w", err)
+	}
+	if pdf.Pages, err = probe.ParsePageCount(out); err != nil {
+		return nil, err
+	}
+	return pdf, nil
+}
+
+func pdfHeaderVersion(inputPath string) string {
+	f, err := os.Open(inputPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	head := make([]byte, 16)
+	n, _ := io.ReadFull(f, head)
+	version, ok := bytes.CutPrefix(head[:n], []byte("%PDF-"))
+	if !ok {
+		return ""
+	}
+	end := bytes.IndexFunc(version, func(r rune) bool { return r != '.' && (r < '0' || r > '9') })
+	if end >= 0 {
+		version = version[:end]
+	}
+	return string(version)
+}
@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"context"
+
+	"fileforge/internal/models"
+	"fileforge/internal/operation"
+)
+
+// Task is one unit of work handed to a Func.
+type Task struct {
+	InputPath  string
+	OutputPath string
+	TmpDir     string
+	Params     models.JobParams
+	RembgURL   string
+}
+
+type Func func(ctx context.Context, t Task) error
+
+// Funcs binds each operation in the operation registry to its processor.
+// The worker refuses to start if an operation is missing here.
+var Funcs = map[string]Func{
+	operation.ImageConvert: func(ctx context.Context, t Task) error {
+		return ImageConvert(ctx, t.InputPath, t.OutputPath, t.Params)
+	},
+	operation.ImageCompress: func(ctx context.Context, t Task) error {
+		return ImageCompress(ctx, t.InputPath, t.OutputPath, t.Params)
+	},
+	operation.ImageRemoveBG: func(ctx context.Context, t Task) error {
+		return ImageRemoveBG(ctx, t.InputPath, t.OutputPath, t.RembgURL, t.Params)
+	},
+	operation.PDFCompress: func(ctx context.Context, t Task) error {
+		return PDFCompress(ctx, t.InputPath, t.OutputPath, t.TmpDir, t.Params)
+	},
+	operation.AudioConvert: func(ctx context.Context, t Task) error {
+		return AudioConvert(ctx, t.InputPath, t.OutputPath, t.Params)
+	},
+	operation.AudioCompress: func(ctx context.Context, t Task) error {
+		return AudioCompress(ctx, t.InputPath, t.OutputPath, t.Params)
+	},
+	operation.VideoCompress: func(ctx context.Context, t Task) error {
+		return VideoCompress(ctx, t.InputPath, t.OutputPath, t.Params)
+	},
+	operation.Probe: func(ctx context.Context, t Task) error {
+		return Probe(ctx, t.InputPath, t.OutputPath)
+	},
+}
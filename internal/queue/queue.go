@@ -9,7 +9,41 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-const queueKey = "fileforge:jobs:pending"
+const (
+	queueKey    = "fileforge:jobs:pending"
+	priorityKey = "fileforge:jobs:priority"
+
+	doneKeyPrefix = "fileforge:jobs:done:"
+	doneTTL       = time.Minute
+
+	cancelChannel = "fileforge:jobs:cancel"
+)
+
+type lane struct {
+	name string
+	key  string
+}
+
+// lanes are listed in the order workers drain them.
+var lanes = []lane{
+	{name: "priority", key: priorityKey},
+	{name: "pending", key: queueKey},
+}
+
+func laneKeys() []string {
+	keys := make([]string, len(lanes))
+	for i, l := range lanes {
+		keys[i] = l.key
+	}
+	return keys
+}
+
+type LaneInfo struct {
+	Name   string   `json:"name"`
+	Key    string   `json:"key"`
+	Length int64    `json:"length"`
+	Next   []string `json:"next"`
+}
 
 type Queue struct {
 	client *redis.Client
@@ -63,8 +97,17 @@ func (q *Queue) Enqueue(ctx context.Context, jobID string) error {
 	return nil
 }
 
+// EnqueuePriority queues a job ahead of everything in the pending lane. It
+// is used for synchronous requests where a client is waiting on the result.
+func (q *Queue) EnqueuePriority(ctx context.Context, jobID string) error {
+	if err := q.client.LPush(ctx, priorityKey, jobID).Err(); err != nil {
+		return fmt.Errorf("enqueue priority job %s: %w", jobID, err)
+	}
+	return nil
+}
+
 func (q *Queue) Dequeue(ctx context.Context, timeout time.Duration) (string, error) {
-	result, err := q.client.BRPop(ctx, timeout, queueKey).Result()
+	result, err := q.client.BRPop(ctx, timeout, laneKeys()...).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return "", nil
@@ -83,11 +126,15 @@ func (q *Queue) Dequeue(ctx context.Context, timeout time.Duration) (string, err
 }
 
 func (q *Queue) Length(ctx context.Context) (int64, error) {
-	n, err := q.client.LLen(ctx, queueKey).Result()
-	if err != nil {
-		return 0, fmt.Errorf("queue length: %w", err)
+	var total int64
+	for _, l := range lanes {
+		n, err := q.client.LLen(ctx, l.key).Result()
+		if err != nil {
+			return 0, fmt.Errorf("queue length: %w", err)
+		}
+		total += n
 	}
-	return n, nil
+	return total, nil
 }
 
 func (q *Queue) Requeue(ctx context.Context, jobID string) error {
@@ -95,4 +142,109 @@ func (q *Queue) Requeue(ctx context.Context, jobID string) error {
 		return fmt.Errorf("requeue job %s: %w", jobID, err)
 	}
 	return nil
+}
+
+// NotifyDone signals that a job reached a terminal state, waking a request
+// blocked in WaitDone. The signal expires quickly, so it is harmless when
+// nobody is waiting and still seen by a waiter that arrives late.
+func (q *Queue) NotifyDone(ctx context.Context, jobID string) error {
+	key := doneKeyPrefix + jobID
+	pipe := q.client.TxPipeline()
+	pipe.LPush(ctx, key, "1")
+	pipe.Expire(ctx, key, doneTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("notify done %s: %w", jobID, err)
+	}
+	return nil
+}
+
+// WaitDone blocks until NotifyDone is called for jobID or timeout passes,
+// and reports whether the job finished.
+func (q *Queue) WaitDone(ctx context.Context, jobID string, timeout time.Duration) (bool, error) {
+	err := q.client.BLPop(ctx, timeout, doneKeyPrefix+jobID).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("wait done %s: %w", jobID, err)
+	}
+	return true, nil
+}
+
+// Cancel removes jobs from every lane and tells workers to abandon any of
+// them they are processing. It returns how many were still queued.
+func (q *Queue) Cancel(ctx context.Context, jobIDs []string) (int64, error) {
+	if len(jobIDs) == 0 {
+		return 0, nil
+	}
+
+	pipe := q.client.Pipeline()
+	removed := make([]*redis.IntCmd, 0, len(jobIDs)*len(lanes))
+	for _, id := range jobIDs {
+		for _, l := range lanes {
+			removed = append(removed, pipe.LRem(ctx, l.key, 0, id))
+		}
+		pipe.Publish(ctx, cancelChannel, id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("cancel jobs: %w", err)
+	}
+
+	var n int64
+	for _, cmd := range removed {
+		n += cmd.Val()
+	}
+	return n, nil
+}
+
+// Cancellations delivers the job IDs passed to Cancel until ctx is done.
+// IDs cancelled while nobody is subscribed are not replayed.
+func (q *Queue) Cancellations(ctx context.Context) <-chan string {
+	sub := q.client.Subscribe(ctx, cancelChannel)
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+
+		msgs := sub.Channel()
+		for {
+			select {
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				select {
+				case out <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Lanes reports each queue lane with its length and the next job IDs that a
+// worker would pick up (BRPOP takes from the tail of the list).
+func (q *Queue) Lanes(ctx context.Context, peek int) ([]LaneInfo, error) {
+	infos := make([]LaneInfo, 0, len(lanes))
+	for _, l := range lanes {
+		n, err := q.client.LLen(ctx, l.key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("lane %s length: %w", l.name, err)
+		}
+
+		next, err := q.client.LRange(ctx, l.key, int64(-peek), -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("lane %s peek: %w", l.name, err)
+		}
+		for i, j := 0, len(next)-1; i < j; i, j = i+1, j-1 {
+			next[i], next[j] = next[j], next[i]
+		}
+
+		infos = append(infos, LaneInfo{Name: l.name, Key: l.key, Length: n, Next: next})
+	}
+	return infos, nil
 }
\ No newline at end of file
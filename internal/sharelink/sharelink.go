@@ -0,0 +1,71 @@
+// Package sharelink signs and verifies public download tokens for job
+// outputs. A token only proves that the link was issued by us and has not
+// expired; revocation and download limits live in the share_links table.
+package sharelink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	payloadLen = 16 + 8
+	sigLen     = 16
+)
+
+var (
+	ErrInvalid = errors.New("invalid share token")
+	ErrExpired = errors.New("share link expired")
+)
+
+// Sign returns the token for a link. It is deterministic, so the token of
+// an existing link can be rebuilt from its ID and expiry.
+func Sign(key []byte, linkID string, expiresAt time.Time) (string, error) {
+	id, err := uuid.Parse(linkID)
+	if err != nil {
+		return "", ErrInvalid
+	}
+
+	buf := make([]byte, payloadLen, payloadLen+sigLen)
+	copy(buf, id[:])
+	binary.BigEndian.PutUint64(buf[16:], uint64(expiresAt.Unix()))
+	buf = append(buf, sign(key, buf)...)
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Verify checks the signature and expiry of token and returns the link ID.
+func Verify(key []byte, token string) (string, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(buf) != payloadLen+sigLen {
+		return "", ErrInvalid
+	}
+
+	payload, sig := buf[:payloadLen], buf[payloadLen:]
+	if !hmac.Equal(sig, sign(key, payload)) {
+		return "", ErrInvalid
+	}
+
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(payload[16:])), 0)
+	if time.Now().After(expiresAt) {
+		return "", ErrExpired
+	}
+
+	id, err := uuid.FromBytes(payload[:16])
+	if err != nil {
+		return "", ErrInvalid
+	}
+	return id.String(), nil
+}
+
+func sign(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)[:sigLen]
+}
@@ -0,0 +1,179 @@
+// Package sniff identifies file formats from their leading bytes. It knows a
+// signature for every input format in models.MimeTypes and reports the canonical
+// extension (jpeg, not jpg), so results compare directly with normalized
+// file extensions.
+package sniff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+)
+
+// HeaderSize is how many leading bytes Detect needs to tell every supported
+// format apart.
+const HeaderSize = 512
+
+// Reader detects the format of r without consuming it. The returned reader
+// yields the whole stream, including the bytes that were inspected; after a
+// read error it yields what arrived before the error, then the error.
+func Reader(r io.Reader) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, HeaderSize)
+	head, err := br.Peek(HeaderSize)
+	if err != nil && err != io.EOF {
+		return br, "", err
+	}
+	return br, Detect(head), nil
+}
+
+var asfHeader = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6, 0xD9, 0x00, 0xAA, 0x00, 0x62, 0xCE, 0x6C}
+
+// Detect returns the format of a file starting with head, or "" if it
+// matches no known signature.
+func Detect(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "gif"
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return "tiff"
+	case bytes.HasPrefix(head, []byte("BM")) && bmpHeader(head):
+		return "bmp"
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return "pdf"
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return "flac"
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return "mp3"
+	case bytes.HasPrefix(head, asfHeader):
+		return "wma"
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return ogg(head)
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return ebml(head)
+	}
+
+	if len(head) >= 12 {
+		switch {
+		case string(head[0:4]) == "RIFF":
+			switch string(head[8:12]) {
+			case "WEBP":
+				return "webp"
+			case "WAVE":
+				return "wav"
+			case "AVI ":
+				return "avi"
+			}
+		case string(head[0:4]) == "FORM":
+			switch string(head[8:12]) {
+			case "AIFF", "AIFC":
+				return "aiff"
+			}
+		case string(head[4:8]) == "ftyp":
+			return isoBMFF(head)
+		}
+	}
+
+	return mpegAudio(head)
+}
+
+// bmpHeader checks that the DIB header size is one of the known variants,
+// since "BM" alone is too weak a signature.
+func bmpHeader(head []byte) bool {
+	if len(head) < 18 {
+		return true
+	}
+	switch binary.LittleEndian.Uint32(head[14:18]) {
+	case 12, 40, 52, 56, 64, 108, 124:
+		return true
+	}
+	return false
+}
+
+// ogg tells Opus from other Ogg streams by the first packet's magic.
+func ogg(head []byte) string {
+	if len(head) >= 36 && string(head[28:36]) == "OpusHead" {
+		return "opus"
+	}
+	return "ogg"
+}
+
+// ebml tells WebM from Matroska by the DocType element in the EBML header.
+func ebml(head []byte) string {
+	i := bytes.Index(head, []byte{0x42, 0x82})
+	if i >= 0 && i+3 < len(head) {
+		n := int(head[i+2] & 0x7F)
+		if end := i + 3 + n; n > 0 && end <= len(head) && string(head[i+3:end]) == "webm" {
+			return "webm"
+		}
+	}
+	return "mkv"
+}
+
+// isoBMFF classifies ISO base media files by their major brand, falling back
+// to the compatible brands for generic ones.
+func isoBMFF(head []byte) string {
+	size := int(binary.BigEndian.Uint32(head[0:4]))
+	if size < 16 || size > len(head) {
+		size = len(head)
+	}
+
+	brands := []string{string(head[8:12])}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, string(head[i:i+4]))
+	}
+
+	for _, b := range brands {
+		switch b {
+		case "avif", "avis":
+			return "avif"
+		case "heic", "heix", "hevc", "hevx", "heim", "heis":
+			return "heic"
+		case "mif1", "msf1":
+			return "heif"
+		case "qt  ":
+			return "mov"
+		case "M4A ", "M4B ", "M4P ":
+			return "m4a"
+		}
+	}
+	return "mp4"
+}
+
+// refinements lists, for detected formats that stand for a container family,
+// the member formats the leading bytes cannot always tell apart: ISO files
+// with a generic brand such as isom or mp42 are reported as mp4 even when
+// they are .m4a audio or QuickTime movies.
+var refinements = map[string][]string{
+	"mp4": {"m4a", "mov"},
+}
+
+// Refines reports whether the normalized extension ext names a more specific
+// format within the family of detected, so the extension should be trusted
+// over the content.
+func Refines(detected, ext string) bool {
+	return slices.Contains(refinements[detected], ext)
+}
+
+// mpegAudio recognises raw MPEG audio frames: ADTS AAC (layer 0) and MP3
+// (layers I–III).
+func mpegAudio(head []byte) string {
+	if len(head) < 4 || head[0] != 0xFF || head[1]&0xE0 != 0xE0 {
+		return ""
+	}
+	layer := (head[1] >> 1) & 0x03
+	if head[1]&0xF6 == 0xF0 {
+		return "aac"
+	}
+	version := (head[1] >> 3) & 0x03
+	bitrate := head[2] >> 4
+	if layer != 0 && version != 1 && bitrate != 0x0F && head[2]>>2&0x03 != 0x03 {
+		return "mp3"
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package sniff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// ftyp builds the ftyp box an ISO base media file starts with.
+func ftyp(major string, compatible ...string) []byte {
+	box := make([]byte, 16, 16+4*len(compatible))
+	binary.BigEndian.PutUint32(box[0:4], uint32(16+4*len(compatible)))
+	copy(box[4:8], "ftyp")
+	copy(box[8:12], major)
+	for _, b := range compatible {
+		box = append(box, b...)
+	}
+	return append(box, "\x00\x00\x00\x08free"...)
+}
+
+func bmp(dibSize uint32) []byte {
+	head := make([]byte, 54)
+	copy(head, "BM")
+	binary.LittleEndian.PutUint32(head[14:18], dibSize)
+	return head
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"jpeg", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0, 0x10, 'J', 'F', 'I', 'F'}, "jpeg"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), "png"},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), "gif"},
+		{"tiff little endian", []byte("II*\x00\x08\x00\x00\x00"), "tiff"},
+		{"tiff big endian", []byte("MM\x00*\x00\x00\x00\x08"), "tiff"},
+		{"bmp", bmp(40), "bmp"},
+		{"text starting with BM", bmp(0x6c6c6f), ""},
+		{"pdf", []byte("%PDF-1.7\n"), "pdf"},
+		{"flac", []byte("fLaC\x00\x00\x00\x22"), "flac"},
+		{"mp3 with id3", []byte("ID3\x04\x00\x00\x00\x00\x00\x00"), "mp3"},
+		{"mp3 frame", []byte{0xFF, 0xFB, 0x90, 0x64}, "mp3"},
+		{"adts aac", []byte{0xFF, 0xF1, 0x50, 0x80}, "aac"},
+		{"wma", append(append([]byte{}, asfHeader...), 0, 0), "wma"},
+		{"ogg vorbis", append([]byte("OggS"), make([]byte, 24)...), "ogg"},
+		{"opus", append(append([]byte("OggS"), make([]byte, 24)...), "OpusHead"...), "opus"},
+		{"webm", []byte{0x1A, 0x45, 0xDF, 0xA3, 0x9F, 0x42, 0x82, 0x84, 'w', 'e', 'b', 'm'}, "webm"},
+		{"matroska", []byte{0x1A, 0x45, 0xDF, 0xA3, 0xA3, 0x42, 0x82, 0x88, 'm', 'a', 't', 'r', 'o', 's', 'k', 'a'}, "mkv"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "webp"},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "wav"},
+		{"avi", []byte("RIFF\x24\x00\x00\x00AVI LIST"), "avi"},
+		{"aiff", []byte("FORM\x00\x00\x00\x24AIFFCOMM"), "aiff"},
+		{"aifc", []byte("FORM\x00\x00\x00\x24AIFCFVER"), "aiff"},
+		{"mp4 isom", ftyp("isom", "isom", "iso2", "avc1", "mp41"), "mp4"},
+		{"mp4 mp42", ftyp("mp42", "mp42", "isom"), "mp4"},
+		{"m4a brand", ftyp("M4A ", "M4A ", "mp42", "isom"), "m4a"},
+		{"m4b brand", ftyp("M4B ", "M4B ", "mp42"), "m4a"},
+		{"m4a compatible brand", ftyp("mp42", "isom", "M4A "), "m4a"},
+		{"quicktime", ftyp("qt  ", "qt  "), "mov"},
+		{"avif", ftyp("avif", "mif1", "miaf"), "avif"},
+		{"heic", ftyp("heic", "mif1", "heic"), "heic"},
+		{"heif", ftyp("mif1", "mif1", "miaf"), "heif"},
+		{"empty", nil, ""},
+		{"text", []byte("hello, world"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.head); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefines(t *testing.T) {
+	tests := []struct {
+		detected, ext string
+		want          bool
+	}{
+		{"mp4", "m4a", true},
+		{"mp4", "mov", true},
+		{"mp4", "mp4", false},
+		{"mp4", "mkv", false},
+		{"mp4", "", false},
+		{"m4a", "mp4", false},
+		{"mov", "mp4", false},
+		{"jpeg", "png", false},
+		{"", "m4a", false},
+	}
+
+	for _, tt := range tests {
+		if got := Refines(tt.detected, tt.ext); got != tt.want {
+			t.Errorf("Refines(%q, %q) = %v, want %v", tt.detected, tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	data := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("x"), 2*HeaderSize)...)
+
+	r, format, err := Reader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "pdf" {
+		t.Errorf("format = %q, want pdf", format)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Reader consumed %d bytes of the stream", len(data)-len(got))
+	}
+
+	if _, format, err := Reader(strings.NewReader("GIF89a")); err != nil || format != "gif" {
+		t.Errorf("short stream: format = %q, err = %v", format, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type Storage struct {
@@ -38,6 +39,33 @@ func (s *Storage) OutputPath(jobID string) string {
 	return filepath.Join(s.outputsDir, jobID)
 }
 
+// UploadTailPath holds the encrypted partial chunk of a resumable upload.
+func (s *Storage) UploadTailPath(uploadID string) string {
+	return filepath.Join(s.inputsDir, uploadID+".part")
+}
+
+// InputsOlderThan lists the IDs of input files last written before cutoff.
+// The encrypted tails of resumable uploads are not included.
+func (s *Storage) InputsOlderThan(cutoff time.Time) ([]string, error) {
+	entries, err := os.ReadDir(s.inputsDir)
+	if err != nil {
+		return nil, fmt.Errorf("read inputs dir: %w", err)
+	}
+
+	var ids []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() || filepath.Ext(e.Name()) != "" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		ids = append(ids, e.Name())
+	}
+	return ids, nil
+}
+
 func (s *Storage) InputExists(jobID string) bool {
 	_, err := os.Stat(s.InputPath(jobID))
 	return err == nil
@@ -53,6 +81,11 @@ func (s *Storage) DeleteJobFiles(jobID string) {
 	os.Remove(s.OutputPath(jobID))
 }
 
+func (s *Storage) DeleteUploadFiles(uploadID string) {
+	os.Remove(s.InputPath(uploadID))
+	os.Remove(s.UploadTailPath(uploadID))
+}
+
 func (s *Storage) CreateInput(jobID string) (*os.File, error) {
 	p := s.InputPath(jobID)
 	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
@@ -62,6 +95,23 @@ func (s *Storage) CreateInput(jobID string) (*os.File, error) {
 	return f, nil
 }
 
+func (s *Storage) CreateOutput(jobID string) (*os.File, error) {
+	p := s.OutputPath(jobID)
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("create output %s: %w", p, err)
+	}
+	return f, nil
+}
+
+func (s *Storage) DeleteInput(jobID string) {
+	os.Remove(s.InputPath(jobID))
+}
+
+func (s *Storage) DeleteOutput(jobID string) {
+	os.Remove(s.OutputPath(jobID))
+}
+
 func (s *Storage) OpenInput(jobID string) (*os.File, error) {
 	p := s.InputPath(jobID)
 	f, err := os.Open(p)
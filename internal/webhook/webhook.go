@@ -0,0 +1,226 @@
+// Package webhook records callback deliveries when jobs finish and sends
+// them with retries. Deliveries live in Postgres, so they survive restarts
+// and can be replayed from the admin API.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fileforge/internal/database"
+	"fileforge/internal/models"
+	"fileforge/internal/sharelink"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SignatureHeader = "X-FileForge-Signature"
+	EventHeader     = "X-FileForge-Event"
+	DeliveryHeader  = "X-FileForge-Delivery"
+
+	maxErrorLen = 500
+)
+
+// Sign returns the signature header value for body: "t=<unix>,v1=<hex>",
+// where v1 is HMAC-SHA256(secret, "<unix>.<body>"). Receivers should
+// recompute it and reject stale timestamps.
+func Sign(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notifier turns finished jobs into pending deliveries.
+type Notifier struct {
+	DB            *database.DB
+	ShareKey      []byte
+	PublicBaseURL string
+}
+
+// JobFinished records a delivery for a job that reached a terminal state.
+// Jobs without a callback URL are ignored. Completed jobs get a share link
+// valid until the output expires.
+func (n *Notifier) JobFinished(ctx context.Context, job *models.Job) error {
+	if !job.CallbackURL.Valid || !job.APIKeyID.Valid {
+		return nil
+	}
+
+	payload := models.WebhookPayload{
+		DeliveryID: uuid.New().String(),
+		CreatedAt:  time.Now().UTC(),
+		Job:        job.ToResponse(),
+	}
+
+	switch job.Status {
+	case models.StatusCompleted:
+		payload.Event = models.EventJobCompleted
+
+		expiresAt := job.ExpiresAt.Truncate(time.Second)
+		link, err := n.DB.CreateShareLink(ctx, job.ID, job.SessionID, expiresAt, sql.NullInt32{})
+		if err != nil {
+			return err
+		}
+		token, err := sharelink.Sign(n.ShareKey, link.ID, link.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("sign share link: %w", err)
+		}
+		payload.DownloadURL = strings.TrimRight(n.PublicBaseURL, "/") + "/api/s/" + token
+		payload.DownloadExpiresAt = &link.ExpiresAt
+	case models.StatusFailed:
+		payload.Event = models.EventJobFailed
+	default:
+		return nil
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %w", err)
+	}
+
+	jobID := job.ID
+	return n.DB.InsertWebhookDelivery(ctx, &models.WebhookDelivery{
+		ID:       payload.DeliveryID,
+		JobID:    &jobID,
+		APIKeyID: job.APIKeyID.String,
+		Event:    payload.Event,
+		URL:      job.CallbackURL.String,
+		Payload:  body,
+	})
+}
+
+// Dispatcher polls for due deliveries and POSTs them.
+type Dispatcher struct {
+	DB          *database.DB
+	Client      *http.Client
+	MaxAttempts int
+	Timeout     time.Duration
+	Interval    time.Duration
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	log.Printf("[webhook] Dispatcher running every %v", d.Interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[webhook] Dispatcher stopped")
+			return
+		case <-ticker.C:
+			d.runOnce(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) runOnce(ctx context.Context) {
+	for {
+		due, err := d.DB.ClaimWebhookDeliveries(ctx, 10, d.Timeout+30*time.Second)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[webhook] %v", err)
+			}
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+		for _, w := range due {
+			d.deliver(ctx, w)
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, w *database.DueWebhook) {
+	if w.KeyRevoked {
+		d.record(ctx, w, 0, fmt.Errorf("API key revoked"), true)
+		return
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, w.URL, bytes.NewReader(w.Payload))
+	if err != nil {
+		d.record(ctx, w, 0, err, true)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "FileForge-Webhook/1.0")
+	req.Header.Set(EventHeader, w.Event)
+	req.Header.Set(DeliveryHeader, w.ID)
+	req.Header.Set(SignatureHeader, Sign(w.Secret, time.Now(), w.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		d.record(ctx, w, 0, err, false)
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		d.record(ctx, w, resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status), false)
+		return
+	}
+
+	if err := d.DB.MarkWebhookDelivered(ctx, w.ID, resp.StatusCode); err != nil {
+		log.Printf("[webhook] %v", err)
+		return
+	}
+	log.Printf("[webhook] Delivery %s (%s) delivered: %d", w.ID, w.Event, resp.StatusCode)
+}
+
+func (d *Dispatcher) record(ctx context.Context, w *database.DueWebhook, code int, deliverErr error, permanent bool) {
+	msg := deliverErr.Error()
+	if len(msg) > maxErrorLen {
+		msg = msg[:maxErrorLen] + "…"
+	}
+
+	var retryAt time.Time
+	attempt := w.Attempts + 1
+	if !permanent && attempt < d.MaxAttempts {
+		retryAt = time.Now().Add(Backoff(attempt))
+	}
+
+	if err := d.DB.MarkWebhookFailed(ctx, w.ID, code, msg, retryAt); err != nil {
+		log.Printf("[webhook] %v", err)
+		return
+	}
+
+	if retryAt.IsZero() {
+		log.Printf("[webhook] ✗ Delivery %s gave up after %d attempts: %s", w.ID, attempt, msg)
+	} else {
+		log.Printf("[webhook] ↻ Delivery %s attempt %d failed: %s — retry at %s",
+			w.ID, attempt, msg, retryAt.UTC().Format(time.RFC3339))
+	}
+}
+
+// Backoff is 30s doubled per attempt, capped at six hours, with up to 10%
+// jitter so a recovering receiver is not hit by every retry at once.
+func Backoff(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < 6*time.Hour; i++ {
+		d *= 2
+	}
+	d = min(d, 6*time.Hour)
+	return d + time.Duration(rand.Int63n(int64(d/10)+1))
+}
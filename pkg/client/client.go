@@ -0,0 +1,202 @@
+// Package client is a Go client for the FileForge HTTP API. It covers the
+// job lifecycle: upload a file, follow the job's status, download the
+// output and delete it. Requests that fail with a network error, 429 or a
+// 5xx status are retried with exponential backoff; uploads are only retried
+// when the file can be rewound.
+//
+// The API is described by the OpenAPI document served at
+// /api/openapi.json.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrJobFailed is returned by Wait when the job ends in the failed state.
+	ErrJobFailed = errors.New("job failed")
+
+	errNotReplayable = errors.New("request body cannot be replayed")
+)
+
+type Options struct {
+	// APIKey is sent as X-API-Key. Without it requests count against the
+	// anonymous per-IP rate limit.
+	APIKey     string
+	HTTPClient *http.Client
+
+	// MaxAttempts is the number of tries per request, including the first.
+	// Zero means 4; 1 disables retries.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, doubled after each
+	// further attempt up to MaxBackoff. A Retry-After header longer than
+	// MaxBackoff ends the retries instead.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type Client struct {
+	baseURL string
+	http    *http.Client
+	opts    Options
+}
+
+// New returns a client for the API at baseURL, e.g. "https://files.example.com".
+func New(baseURL string, opts Options) *Client {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 4
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 500 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    opts.HTTPClient,
+		opts:    opts,
+	}
+}
+
+// APIError is a response with an error status.
+type APIError struct {
+	StatusCode int
+	// Code is the machine-readable error code; see GET /api/errors.
+	Code    string
+	Message string
+	// RetryAfter is the delay the server asked for, if any.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("fileforge: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the API.
+func IsNotFound(err error) bool {
+	var ae *APIError
+	return errors.As(err, &ae) && ae.StatusCode == http.StatusNotFound
+}
+
+// do sends the request built by newReq, retrying transient failures.
+// newReq is called once per attempt and may return errNotReplayable to stop
+// retrying. Error statuses are returned as *APIError with the body closed.
+func (c *Client) do(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		req, err := newReq()
+		if errors.Is(err, errNotReplayable) && lastErr != nil {
+			return nil, lastErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		if c.opts.APIKey != "" {
+			req.Header.Set("X-API-Key", c.opts.APIKey)
+		}
+
+		resp, err := c.http.Do(req.WithContext(ctx))
+		if err == nil && resp.StatusCode < 400 {
+			return resp, nil
+		}
+		if err == nil {
+			err = readAPIError(resp)
+		}
+		lastErr = err
+
+		wait, retry := c.retryAfter(attempt, err)
+		if !retry || ctx.Err() != nil {
+			return nil, err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// retryAfter decides whether a failed attempt is retried and after how long.
+func (c *Client) retryAfter(attempt int, err error) (time.Duration, bool) {
+	if attempt >= c.opts.MaxAttempts {
+		return 0, false
+	}
+
+	wait := c.opts.MinBackoff << (attempt - 1)
+	if wait <= 0 || wait > c.opts.MaxBackoff {
+		wait = c.opts.MaxBackoff
+	}
+	wait += time.Duration(rand.Int63n(int64(wait/10) + 1))
+
+	var ae *APIError
+	if !errors.As(err, &ae) {
+		// Network errors are worth another try unless the caller gave up.
+		return wait, !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch {
+	case ae.StatusCode == http.StatusTooManyRequests:
+	case ae.StatusCode >= 500 && ae.StatusCode != http.StatusNotImplemented:
+	default:
+		return 0, false
+	}
+	if ae.RetryAfter > 0 {
+		if ae.RetryAfter > c.opts.MaxBackoff {
+			return 0, false
+		}
+		wait = ae.RetryAfter
+	}
+	return wait, true
+}
+
+func readAPIError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	ae := &APIError{StatusCode: resp.StatusCode}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		ae.RetryAfter = time.Duration(secs) * time.Second
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var e struct {
+		Code  string `json:"code"`
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		ae.Code, ae.Message = e.Code, e.Error
+	} else {
+		ae.Message = strings.TrimSpace(string(body))
+	}
+	return ae
+}
+
+// doJSON performs a request without a body and decodes the response into v.
+func (c *Client) doJSON(ctx context.Context, method, path string, v any) error {
+	resp, err := c.do(ctx, func() (*http.Request, error) {
+		return http.NewRequest(method, c.baseURL+path, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeJSON(resp, v)
+}
+
+func decodeJSON(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Format describes what one operation accepts, as listed by GET
+// /api/formats.
+type Format struct {
+	Input         []string `json:"input"`
+	DefaultOutput string   `json:"default_output,omitempty"`
+	Sync          bool     `json:"sync,omitempty"`
+}
+
+// Accepts reports whether a file named name has an input extension of the
+// operation.
+func (f Format) Accepts(name string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	return ext != "" && slices.Contains(f.Input, ext)
+}
+
+// Formats returns the operations the server supports, keyed by name.
+func (c *Client) Formats(ctx context.Context) (map[string]Format, error) {
+	var formats map[string]Format
+	if err := c.doJSON(ctx, http.MethodGet, "/api/formats", &formats); err != nil {
+		return nil, err
+	}
+	return formats, nil
+}
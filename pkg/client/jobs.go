@@ -0,0 +1,381 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+type Job struct {
+	ID             string     `json:"id"`
+	BatchID        string     `json:"batch_id,omitempty"`
+	Operation      string     `json:"operation"`
+	Status         string     `json:"status"`
+	InputSize      int64      `json:"input_size"`
+	OutputSize     int64      `json:"output_size,omitempty"`
+	OriginalName   string     `json:"original_name"`
+	DetectedFormat string     `json:"detected_format,omitempty"`
+	OutputFilename string     `json:"output_filename,omitempty"`
+	ErrorCode      string     `json:"error_code,omitempty"`
+	ErrorMessage   string     `json:"error_message,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+
+	DeleteAfterDownload bool      `json:"delete_after_download,omitempty"`
+	Steps               []JobStep `json:"steps,omitempty"`
+}
+
+// JobStep is the progress of one step of a pipeline job.
+type JobStep struct {
+	Operation    string         `json:"operation"`
+	Params       map[string]any `json:"params"`
+	Status       string         `json:"status"`
+	OutputSize   int64          `json:"output_size,omitempty"`
+	StartedAt    *time.Time     `json:"started_at,omitempty"`
+	CompletedAt  *time.Time     `json:"completed_at,omitempty"`
+	ErrorCode    string         `json:"error_code,omitempty"`
+	ErrorMessage string         `json:"error_message,omitempty"`
+}
+
+// Step is one operation of a pipeline, named by Operation, Preset or both.
+type Step struct {
+	Operation string            `json:"operation,omitempty"`
+	Preset    string            `json:"preset,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+}
+
+// Done reports whether the job has finished, successfully or not.
+func (j *Job) Done() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed
+}
+
+// JobRequest describes a job to create. Either File or SourceURL must be
+// set.
+type JobRequest struct {
+	Operation string
+	// Preset names a server-side preset that supplies the operation and
+	// default parameters; Params and OutputFormat override it.
+	Preset string
+	// Steps runs several operations in order, each on the previous one's
+	// output. It replaces Operation, Preset, Params and OutputFormat.
+	Steps []Step
+	// Params are the operation's parameters as form values, e.g.
+	// {"quality": "80"}. output_format goes in OutputFormat.
+	Params       map[string]string
+	OutputFormat string
+
+	// File is uploaded as Filename. If it implements io.Seeker the upload
+	// is retried from its current position; otherwise it is sent once.
+	File     io.Reader
+	Filename string
+	// Size is the length of File, used only for Progress; -1 if unknown.
+	Size int64
+
+	SourceURL   string
+	CallbackURL string
+
+	// RetentionHours keeps the job this long instead of the server default.
+	RetentionHours int
+	// DeleteAfterDownload makes the server shred the output after its
+	// first complete download.
+	DeleteAfterDownload bool
+
+	// IdempotencyKey makes retried uploads return the job created by the
+	// first attempt. A random key is used when empty.
+	IdempotencyKey string
+
+	// Progress, if set, is called as file bytes are sent. It starts over
+	// from zero when an upload is retried.
+	Progress func(sent, total int64)
+}
+
+// CreateJob uploads a file, or submits a source URL, and returns the queued
+// job.
+func (c *Client) CreateJob(ctx context.Context, req JobRequest) (*Job, error) {
+	if req.File == nil && req.SourceURL == "" {
+		return nil, fmt.Errorf("fileforge: JobRequest needs a File or a SourceURL")
+	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = uuid.NewString()
+	}
+
+	fields := url.Values{}
+	if req.Operation != "" {
+		fields.Set("operation", req.Operation)
+	}
+	if req.Preset != "" {
+		fields.Set("preset", req.Preset)
+	}
+	if len(req.Steps) > 0 {
+		steps, err := json.Marshal(req.Steps)
+		if err != nil {
+			return nil, err
+		}
+		fields.Set("steps", string(steps))
+	}
+	for k, v := range req.Params {
+		fields.Set(k, v)
+	}
+	if req.OutputFormat != "" {
+		fields.Set("output_format", req.OutputFormat)
+	}
+	if req.SourceURL != "" {
+		fields.Set("source_url", req.SourceURL)
+	}
+	if req.CallbackURL != "" {
+		fields.Set("callback_url", req.CallbackURL)
+	}
+	if req.RetentionHours > 0 {
+		fields.Set("retention_hours", strconv.Itoa(req.RetentionHours))
+	}
+	if req.DeleteAfterDownload {
+		fields.Set("delete_after_download", "true")
+	}
+
+	seeker, _ := req.File.(io.Seeker)
+	var start int64
+	if seeker != nil {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seeker = nil
+		}
+	}
+
+	// The transport may close a request body after Do returns, so the
+	// previous attempt's writer can still be reading the file. It is stopped
+	// before a seekable file is rewound or handed back to the caller.
+	var body io.ReadCloser
+	var written <-chan struct{}
+	stopWriter := func() {
+		if body != nil {
+			body.Close()
+			if seeker != nil {
+				<-written
+			}
+		}
+	}
+	defer stopWriter()
+
+	resp, err := c.do(ctx, func() (*http.Request, error) {
+		if body != nil && req.File != nil {
+			if seeker == nil {
+				return nil, errNotReplayable
+			}
+			stopWriter()
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("rewind upload: %w", err)
+			}
+		}
+
+		var contentType string
+		body, written, contentType = multipartBody(fields, req)
+		r, err := http.NewRequest(http.MethodPost, c.baseURL+"/api/jobs", body)
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Content-Type", contentType)
+		r.Header.Set("Idempotency-Key", req.IdempotencyKey)
+		return r, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	if err := decodeJSON(resp, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// multipartBody streams the form through a pipe so large files are never
+// held in memory. Fields precede the file because the server validates
+// them before accepting the upload. The returned channel is closed once the
+// writer has stopped reading the file.
+func multipartBody(fields url.Values, req JobRequest) (io.ReadCloser, <-chan struct{}, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		err := func() error {
+			for k, vs := range fields {
+				for _, v := range vs {
+					if err := mw.WriteField(k, v); err != nil {
+						return err
+					}
+				}
+			}
+			if req.File != nil {
+				part, err := mw.CreateFormFile("file", filepath.Base(req.Filename))
+				if err != nil {
+					return err
+				}
+				var src io.Reader = req.File
+				if req.Progress != nil {
+					src = &progressReader{r: req.File, total: req.Size, fn: req.Progress}
+				}
+				if _, err := io.Copy(part, src); err != nil {
+					return err
+				}
+			}
+			return mw.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+
+	return pr, done, mw.FormDataContentType()
+}
+
+type progressReader struct {
+	r     io.Reader
+	sent  int64
+	total int64
+	fn    func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.fn(p.sent, p.total)
+	}
+	return n, err
+}
+
+// UploadFile creates a job from the file at path.
+func (c *Client) UploadFile(ctx context.Context, path string, req JobRequest) (*Job, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	req.File = f
+	req.Size = info.Size()
+	if req.Filename == "" {
+		req.Filename = filepath.Base(path)
+	}
+	return c.CreateJob(ctx, req)
+}
+
+// Job returns the current state of a job.
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.doJSON(ctx, http.MethodGet, "/api/jobs/"+url.PathEscape(id), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Wait polls a job every interval until it finishes, calling onStatus, if
+// set, whenever the status changes. A failed job is returned together with
+// an error wrapping ErrJobFailed.
+func (c *Client) Wait(ctx context.Context, id string, interval time.Duration, onStatus func(*Job)) (*Job, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var last string
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status != last && onStatus != nil {
+			onStatus(job)
+		}
+		last = job.Status
+
+		switch job.Status {
+		case StatusCompleted:
+			return job, nil
+		case StatusFailed:
+			return job, fmt.Errorf("%w: %s", ErrJobFailed, job.ErrorMessage)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Download writes a completed job's output to w and returns the number of
+// bytes written. Only the request is retried; an error while copying the
+// body is returned as is, since part of the output may already be in w.
+func (c *Client) Download(ctx context.Context, id string, w io.Writer) (int64, error) {
+	resp, err := c.do(ctx, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, c.baseURL+"/api/jobs/"+url.PathEscape(id)+"/download", nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("download job %s: %w", id, err)
+	}
+	return n, nil
+}
+
+// SetRetention makes a job expire hours from now. The server rejects
+// retentions past its maximum, counted from the job's creation.
+func (c *Client) SetRetention(ctx context.Context, id string, hours int) (*Job, error) {
+	body, err := json.Marshal(map[string]int{"retention_hours": hours})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, func() (*http.Request, error) {
+		r, err := http.NewRequest(http.MethodPatch, c.baseURL+"/api/jobs/"+url.PathEscape(id), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Content-Type", "application/json")
+		return r, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := decodeJSON(resp, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Delete removes a job and its files.
+func (c *Client) Delete(ctx context.Context, id string) error {
+	var resp struct {
+		Status string `json:"status"`
+	}
+	return c.doJSON(ctx, http.MethodDelete, "/api/jobs/"+url.PathEscape(id), &resp)
+}